@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/emersion/gnomeconnect/service"
+	"github.com/godbus/dbus"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const usage = `Usage: gnomeconnect [--device <device> [file...]]
+       gnomeconnect [--json] <command>
+
+Without command, starts GNOMEConnect or opens the window of the running
+instance. If --device is specified, the window opens on this device and files
+are sent to it.
+
+Commands:
+  list                          List devices
+  ping <device>                 Send a ping
+  ring <device>                 Make a device ring
+  pair <device>                 Pair with a device
+  unpair <device>               Unpair a device
+  browse <device>               Browse a device's files
+  share <device> <file>...      Send files
+  sms <device> <number> <text>  Send an SMS
+
+Devices can be designated by ID or name.
+`
+
+var cliCommands = []string{"list", "ping", "ring", "pair", "unpair", "browse", "share", "sms", "help"}
+
+// parseCliArgs parses the flags before the command. Parsing stops at the first
+// positional argument or unknown flag, the remaining arguments are returned
+// unchanged in cmdArgs.
+func parseCliArgs(args []string) (jsonOutput, help bool, cmdArgs []string) {
+	for i, arg := range args {
+		switch arg {
+		case "--json", "-json":
+			jsonOutput = true
+		case "--help", "-help", "-h":
+			help = true
+		case "--":
+			return jsonOutput, help, args[i+1:]
+		default:
+			cmdArgs = args[i:]
+			if len(cmdArgs) > 0 && cmdArgs[0] == "help" {
+				help = true
+			}
+			return
+		}
+	}
+	return
+}
+
+// isCli checks whether command-line arguments designate a client command.
+func isCli(args []string) bool {
+	jsonOutput, help, cmdArgs := parseCliArgs(args)
+	if jsonOutput || help {
+		return true
+	}
+
+	if len(cmdArgs) == 0 {
+		return false
+	}
+	for _, cmd := range cliCommands {
+		if cmdArgs[0] == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+var errDaemonNotRunning = errors.New("GNOMEConnect is not running")
+
+type cliDevice struct {
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Paired    bool   `json:"paired"`
+	Reachable bool   `json:"reachable"`
+	Battery   int    `json:"battery"`
+	Charging  bool   `json:"charging"`
+
+	path dbus.ObjectPath
+}
+
+type cliClient struct {
+	conn *dbus.Conn
+}
+
+func (c *cliClient) listDevices() ([]*cliDevice, error) {
+	var paths []dbus.ObjectPath
+	err := c.conn.Object(service.Name, service.Path).Call(service.DaemonInterface+".ListDevices", 0).Store(&paths)
+	if err != nil {
+		if dbusErr, ok := err.(dbus.Error); ok && dbusErr.Name == "org.freedesktop.DBus.Error.ServiceUnknown" {
+			return nil, errDaemonNotRunning
+		}
+		return nil, err
+	}
+
+	devices := make([]*cliDevice, 0, len(paths))
+	for _, path := range paths {
+		var props map[string]dbus.Variant
+		err := c.conn.Object(service.Name, path).Call("org.freedesktop.DBus.Properties.GetAll", 0, service.DeviceInterface).Store(&props)
+		if err != nil {
+			return nil, err
+		}
+
+		d := &cliDevice{path: path}
+		d.Id, _ = props["Id"].Value().(string)
+		d.Name, _ = props["Name"].Value().(string)
+		d.Type, _ = props["Type"].Value().(string)
+		d.Paired, _ = props["Paired"].Value().(bool)
+		d.Reachable, _ = props["Reachable"].Value().(bool)
+		battery, _ := props["Battery"].Value().(int32)
+		d.Battery = int(battery)
+		d.Charging, _ = props["Charging"].Value().(bool)
+		devices = append(devices, d)
+	}
+
+	return devices, nil
+}
+
+// findDevice returns the device having this ID or name.
+func (c *cliClient) findDevice(name string) (*cliDevice, error) {
+	devices, err := c.listDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range devices {
+		if d.Id == name {
+			return d, nil
+		}
+	}
+	for _, d := range devices {
+		if strings.EqualFold(d.Name, name) {
+			return d, nil
+		}
+	}
+
+	return nil, fmt.Errorf("No such device: %v", name)
+}
+
+func (c *cliClient) callDevice(name, method string, args ...interface{}) error {
+	d, err := c.findDevice(name)
+	if err != nil {
+		return err
+	}
+
+	return c.conn.Object(service.Name, d.path).Call(service.DeviceInterface+"."+method, 0, args...).Err
+}
+
+func printDevices(devices []*cliDevice, jsonOutput bool) {
+	if jsonOutput {
+		json.NewEncoder(os.Stdout).Encode(devices)
+		return
+	}
+
+	for _, d := range devices {
+		status := "available"
+		if d.Paired && d.Reachable {
+			status = "connected"
+		} else if d.Paired {
+			status = "paired, unreachable"
+		}
+		if d.Battery >= 0 {
+			status += fmt.Sprintf(", battery %v%%", d.Battery)
+			if d.Charging {
+				status += " (charging)"
+			}
+		}
+
+		fmt.Printf("%v\t%v (%v)\t%v\n", d.Id, d.Name, d.Type, status)
+	}
+}
+
+func runCommand(c *cliClient, args []string, jsonOutput bool) error {
+	if len(args) == 0 {
+		return errors.New("No command specified")
+	}
+
+	cmd, args := args[0], args[1:]
+	switch {
+	case cmd == "list" && len(args) == 0:
+		devices, err := c.listDevices()
+		if err != nil {
+			return err
+		}
+		printDevices(devices, jsonOutput)
+		return nil
+	case cmd == "ping" && len(args) == 1:
+		return c.callDevice(args[0], "Ping")
+	case cmd == "ring" && len(args) == 1:
+		return c.callDevice(args[0], "Ring")
+	case cmd == "pair" && len(args) == 1:
+		return c.callDevice(args[0], "Pair")
+	case cmd == "unpair" && len(args) == 1:
+		return c.callDevice(args[0], "Unpair")
+	case cmd == "browse" && len(args) == 1:
+		return c.callDevice(args[0], "Browse")
+	case cmd == "share" && len(args) >= 2:
+		for _, file := range args[1:] {
+			path, err := filepath.Abs(file)
+			if err != nil {
+				return err
+			}
+			if err := c.callDevice(args[0], "SendFile", path); err != nil {
+				return err
+			}
+		}
+		return nil
+	case cmd == "sms" && len(args) >= 3:
+		return c.callDevice(args[0], "SendSms", args[1], strings.Join(args[2:], " "))
+	default:
+		return fmt.Errorf("Invalid command: %v", strings.Join(append([]string{cmd}, args...), " "))
+	}
+}
+
+// runCli runs a command-line client command and returns the process' exit
+// code.
+func runCli(args []string) int {
+	jsonOutput, help, cmdArgs := parseCliArgs(args)
+	if help {
+		fmt.Print(usage)
+		return 0
+	}
+
+	conn, err := dbus.SessionBus()
+	if err == nil {
+		err = runCommand(&cliClient{conn: conn}, cmdArgs, jsonOutput)
+	}
+
+	if jsonOutput {
+		result := map[string]interface{}{"ok": err == nil}
+		if err != nil {
+			result["error"] = err.Error()
+		}
+		if err != nil || (len(cmdArgs) > 0 && cmdArgs[0] != "list") {
+			json.NewEncoder(os.Stdout).Encode(result)
+		}
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		if len(cmdArgs) == 0 || strings.HasPrefix(err.Error(), "Invalid command") {
+			fmt.Fprint(os.Stderr, usage)
+		}
+	}
+
+	if err != nil {
+		return 1
+	}
+	return 0
+}
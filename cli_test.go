@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCliArgs(t *testing.T) {
+	tests := []struct {
+		args       []string
+		jsonOutput bool
+		help       bool
+		cmdArgs    []string
+	}{
+		{nil, false, false, nil},
+		{[]string{"list"}, false, false, []string{"list"}},
+		{[]string{"--json", "list"}, true, false, []string{"list"}},
+		{[]string{"-h"}, false, true, nil},
+		{[]string{"help"}, false, true, []string{"help"}},
+		// Flags after the command are left to the command
+		{[]string{"sms", "phone", "0612345678", "I", "need", "help"}, false, false, []string{"sms", "phone", "0612345678", "I", "need", "help"}},
+		{[]string{"sms", "phone", "0612345678", "-h", "--json"}, false, false, []string{"sms", "phone", "0612345678", "-h", "--json"}},
+		{[]string{"share", "phone", "--help"}, false, false, []string{"share", "phone", "--help"}},
+		{[]string{"--json", "--", "share", "phone", "-h"}, true, false, []string{"share", "phone", "-h"}},
+		{[]string{"--device", "phone", "--json"}, false, false, []string{"--device", "phone", "--json"}},
+	}
+
+	for _, test := range tests {
+		jsonOutput, help, cmdArgs := parseCliArgs(test.args)
+		if jsonOutput != test.jsonOutput || help != test.help || !reflect.DeepEqual(cmdArgs, test.cmdArgs) {
+			t.Errorf("parseCliArgs(%q) = %v, %v, %q, expected %v, %v, %q", test.args, jsonOutput, help, cmdArgs, test.jsonOutput, test.help, test.cmdArgs)
+		}
+	}
+}
+
+func TestIsCli(t *testing.T) {
+	tests := []struct {
+		args  []string
+		isCli bool
+	}{
+		{nil, false},
+		{[]string{"list"}, true},
+		{[]string{"--json", "list"}, true},
+		{[]string{"--help"}, true},
+		{[]string{"--device", "phone"}, false},
+		{[]string{"--device", "phone", "notes-help.txt", "-h"}, false},
+	}
+
+	for _, test := range tests {
+		if isCli := isCli(test.args); isCli != test.isCli {
+			t.Errorf("isCli(%q) = %v, expected %v", test.args, isCli, test.isCli)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Package contacts resolves phone numbers to contact names using the desktop
+// address books.
+package contacts
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Address books are reloaded after this delay.
+const cacheDuration = 5 * time.Minute
+
+// Phone numbers are considered equal if their last significant digits match.
+// This is enough to match international and national forms, e.g.
+// "+33 6 12 34 56 78" and "06 12 34 56 78".
+const significantDigits = 9
+
+type Contact struct {
+	Name         string
+	PhoneNumbers []string
+}
+
+// A Source is an address book.
+type Source interface {
+	Contacts() ([]*Contact, error)
+}
+
+// NormalizeNumber strips all formatting and international prefixes from a
+// phone number, keeping only digits.
+func NormalizeNumber(number string) string {
+	digits := make([]rune, 0, len(number))
+	for _, r := range number {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, r)
+		}
+	}
+
+	normalized := string(digits)
+	if strings.HasPrefix(number, "+") {
+		return normalized
+	}
+	return strings.TrimPrefix(normalized, "00")
+}
+
+// IsPhoneNumber checks whether a string looks like a phone number: digits
+// with optional formatting characters, and an optional leading "+".
+func IsPhoneNumber(s string) bool {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "+")
+	if s == "" {
+		return false
+	}
+
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+		case r == ' ', r == '-', r == '.', r == '(', r == ')':
+		default:
+			return false
+		}
+	}
+	return NormalizeNumber(s) != ""
+}
+
+// MatchNumbers checks whether two phone numbers are the same.
+func MatchNumbers(a, b string) bool {
+	a = NormalizeNumber(a)
+	b = NormalizeNumber(b)
+
+	if a == "" || b == "" {
+		return false
+	}
+	if a == b {
+		return true
+	}
+	if len(a) < significantDigits || len(b) < significantDigits {
+		return false
+	}
+
+	return a[len(a)-significantDigits:] == b[len(b)-significantDigits:]
+}
+
+// A Resolver looks up phone numbers in a list of address books.
+type Resolver struct {
+	sources []Source
+
+	locker   sync.Mutex
+	contacts []*Contact
+	loadedAt time.Time
+}
+
+func (r *Resolver) load() {
+	if time.Since(r.loadedAt) < cacheDuration {
+		return
+	}
+
+	r.contacts = nil
+	for _, src := range r.sources {
+		// Keep the contacts loaded before the error, if any
+		contacts, err := src.Contacts()
+		if err != nil {
+			log.Println("Cannot load contacts:", err)
+		}
+		r.contacts = append(r.contacts, contacts...)
+	}
+	r.loadedAt = time.Now()
+}
+
+// Lookup returns the name of the contact having this phone number. ok is false
+// if no such contact exists.
+func (r *Resolver) Lookup(number string) (name string, ok bool) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	r.load()
+
+	for _, c := range r.contacts {
+		for _, n := range c.PhoneNumbers {
+			if MatchNumbers(n, number) {
+				return c.Name, true
+			}
+		}
+	}
+	return
+}
+
+// Find returns the first phone number of the contact having this name. The
+// search is case-insensitive.
+func (r *Resolver) Find(name string) (number string, ok bool) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	r.load()
+
+	for _, c := range r.contacts {
+		if strings.EqualFold(c.Name, name) && len(c.PhoneNumbers) > 0 {
+			return c.PhoneNumbers[0], true
+		}
+	}
+	return
+}
+
+// Resolve returns a display name for a phone number. contactName is the name
+// sent by the device, if any: it is used in priority.
+func (r *Resolver) Resolve(number, contactName string) string {
+	if contactName != "" {
+		return contactName
+	}
+	if number == "" {
+		return "unknown number"
+	}
+
+	if name, ok := r.Lookup(number); ok {
+		return name
+	}
+	return number
+}
+
+func NewResolver(sources ...Source) *Resolver {
+	return &Resolver{sources: sources}
+}
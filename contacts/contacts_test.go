@@ -0,0 +1,81 @@
+package contacts
+
+import (
+	"testing"
+)
+
+func TestNormalizeNumber(t *testing.T) {
+	tests := []struct {
+		number     string
+		normalized string
+	}{
+		{"0612345678", "0612345678"},
+		{"06 12 34 56 78", "0612345678"},
+		{"+33 6 12 34 56 78", "33612345678"},
+		{"0033 6 12 34 56 78", "33612345678"},
+		{"(555) 123-4567", "5551234567"},
+		{"+1 555.123.4567", "15551234567"},
+		{"112", "112"},
+		{"Bob", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if normalized := NormalizeNumber(test.number); normalized != test.normalized {
+			t.Errorf("NormalizeNumber(%q) = %q, expected %q", test.number, normalized, test.normalized)
+		}
+	}
+}
+
+func TestIsPhoneNumber(t *testing.T) {
+	tests := []struct {
+		s       string
+		isPhone bool
+	}{
+		{"0612345678", true},
+		{"+33 6 12 34 56 78", true},
+		{"(555) 123-4567", true},
+		{"555.123.4567", true},
+		{"112", true},
+		{"Bob 2", false},
+		{"Bob", false},
+		{"+", false},
+		{"()", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if isPhone := IsPhoneNumber(test.s); isPhone != test.isPhone {
+			t.Errorf("IsPhoneNumber(%q) = %v, expected %v", test.s, isPhone, test.isPhone)
+		}
+	}
+}
+
+func TestMatchNumbers(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		match bool
+	}{
+		{"0612345678", "0612345678", true},
+		{"+33 6 12 34 56 78", "06 12 34 56 78", true},
+		{"+33612345678", "0033612345678", true},
+		{"0033 6 12 34 56 78", "0612345678", true},
+		{"(555) 123-4567", "+1 555-123-4567", true},
+		{"112", "112", true},
+		{"0612345678", "0612345679", false},
+		{"+33 6 12 34 56 78", "+33 7 12 34 56 78", false},
+		// Short numbers must match exactly
+		{"1234", "01234", false},
+		{"", "", false},
+		{"Bob", "Alice", false},
+	}
+
+	for _, test := range tests {
+		if match := MatchNumbers(test.a, test.b); match != test.match {
+			t.Errorf("MatchNumbers(%q, %q) = %v, expected %v", test.a, test.b, match, test.match)
+		}
+		if match := MatchNumbers(test.b, test.a); match != test.match {
+			t.Errorf("MatchNumbers(%q, %q) = %v, expected %v", test.b, test.a, match, test.match)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package contacts
+
+import (
+	"github.com/godbus/dbus"
+	"strings"
+)
+
+const (
+	edsAddressBookService = "org.gnome.evolution.dataserver.AddressBook10"
+	edsFactoryPath        = "/org/gnome/evolution/dataserver/AddressBookFactory"
+	edsFactoryInterface   = "org.gnome.evolution.dataserver.AddressBookFactory"
+	edsBookInterface      = "org.gnome.evolution.dataserver.AddressBook"
+)
+
+// EDS is the Evolution Data Server address book.
+type EDS struct {
+	conn *dbus.Conn
+	uid  string
+}
+
+func (eds *EDS) Contacts() ([]*Contact, error) {
+	factory := eds.conn.Object(edsAddressBookService, edsFactoryPath)
+
+	var path dbus.ObjectPath
+	var busName string
+	err := factory.Call(edsFactoryInterface+".OpenAddressBook", 0, eds.uid).Store(&path, &busName)
+	if err != nil {
+		return nil, err
+	}
+
+	book := eds.conn.Object(busName, path)
+	if call := book.Call(edsBookInterface+".Open", 0); call.Err != nil {
+		return nil, call.Err
+	}
+	defer book.Call(edsBookInterface+".Close", 0)
+
+	var vcards []string
+	err = book.Call(edsBookInterface+".GetContactList", 0, `(exists "phone")`).Store(&vcards)
+	if err != nil {
+		return nil, err
+	}
+
+	var contacts []*Contact
+	for _, raw := range vcards {
+		cards, err := decodeVCards(strings.NewReader(raw))
+		if err != nil {
+			return contacts, err
+		}
+		contacts = append(contacts, cards...)
+	}
+
+	return contacts, nil
+}
+
+// NewEDS returns the default Evolution Data Server address book.
+func NewEDS(conn *dbus.Conn) *EDS {
+	return &EDS{
+		conn: conn,
+		uid:  "system-address-book",
+	}
+}
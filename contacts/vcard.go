@@ -0,0 +1,86 @@
+package contacts
+
+import (
+	"github.com/emersion/go-vcard"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// VCardDir is a directory containing vCard files.
+type VCardDir string
+
+func (dir VCardDir) Contacts() ([]*Contact, error) {
+	infos, err := ioutil.ReadDir(string(dir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var contacts []*Contact
+	for _, info := range infos {
+		ext := strings.ToLower(filepath.Ext(info.Name()))
+		if info.IsDir() || (ext != ".vcf" && ext != ".vcard") {
+			continue
+		}
+
+		// A broken file shouldn't hide the contacts of other files
+		path := filepath.Join(string(dir), info.Name())
+		f, err := os.Open(path)
+		if err != nil {
+			log.Println("Cannot open vCard file:", err)
+			continue
+		}
+
+		cards, err := decodeVCards(f)
+		f.Close()
+		if err != nil {
+			log.Println("Cannot decode vCard file "+path+":", err)
+		}
+
+		contacts = append(contacts, cards...)
+	}
+
+	return contacts, nil
+}
+
+func decodeVCards(r io.Reader) ([]*Contact, error) {
+	var contacts []*Contact
+
+	dec := vcard.NewDecoder(r)
+	for {
+		card, err := dec.Decode()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return contacts, err
+		}
+
+		if c := cardToContact(card); c != nil {
+			contacts = append(contacts, c)
+		}
+	}
+
+	return contacts, nil
+}
+
+func cardToContact(card vcard.Card) *Contact {
+	numbers := card.Values(vcard.FieldTelephone)
+	if len(numbers) == 0 {
+		return nil
+	}
+
+	name := card.PreferredValue(vcard.FieldFormattedName)
+	if name == "" {
+		return nil
+	}
+
+	return &Contact{
+		Name:         name,
+		PhoneNumbers: numbers,
+	}
+}
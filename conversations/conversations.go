@@ -0,0 +1,280 @@
+// Package conversations stores SMS conversations of devices.
+package conversations
+
+import (
+	"encoding/json"
+	"github.com/emersion/gnomeconnect/contacts"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Messages received from several sources (e.g. telephony events and
+// conversation sync) are merged if they are this close in time.
+const mergeDelay = 2 * time.Minute
+
+type Message struct {
+	// Remote ID, zero if unknown
+	Id int64 `json:"id,omitempty"`
+	// Remote thread ID, zero if unknown
+	ThreadId int64     `json:"threadId,omitempty"`
+	Address  string    `json:"address"`
+	Body     string    `json:"body"`
+	Date     time.Time `json:"date"`
+	// True if the message has been sent from the device
+	Sent bool `json:"sent,omitempty"`
+}
+
+func (m *Message) matches(other *Message) bool {
+	if m.Id != 0 && other.Id != 0 {
+		return m.Id == other.Id
+	}
+	// Messages without ID are only merged with messages having one, the same
+	// text can be sent twice in a row
+	if m.Id == 0 && other.Id == 0 {
+		return false
+	}
+	if m.Sent != other.Sent || m.Body != other.Body || !contacts.MatchNumbers(m.Address, other.Address) {
+		return false
+	}
+
+	d := m.Date.Sub(other.Date)
+	return -mergeDelay < d && d < mergeDelay
+}
+
+// A Conversation is a list of messages exchanged with a phone number, oldest
+// first.
+type Conversation struct {
+	Address  string     `json:"address"`
+	ThreadId int64      `json:"threadId,omitempty"`
+	Messages []*Message `json:"messages"`
+}
+
+func (c *Conversation) LastMessage() *Message {
+	if len(c.Messages) == 0 {
+		return nil
+	}
+	return c.Messages[len(c.Messages)-1]
+}
+
+func (c *Conversation) add(m *Message) bool {
+	for _, other := range c.Messages {
+		if other.matches(m) {
+			if other.Id == 0 {
+				other.Id = m.Id
+			}
+			return false
+		}
+	}
+
+	c.Messages = append(c.Messages, m)
+	sort.Sort(byDate(c.Messages))
+	if m.ThreadId != 0 {
+		c.ThreadId = m.ThreadId
+	}
+	return true
+}
+
+type byDate []*Message
+
+func (l byDate) Len() int           { return len(l) }
+func (l byDate) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l byDate) Less(i, j int) bool { return l[i].Date.Before(l[j].Date) }
+
+type byLastMessage []Conversation
+
+func (l byLastMessage) Len() int      { return len(l) }
+func (l byLastMessage) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l byLastMessage) Less(i, j int) bool {
+	a, b := l[i].LastMessage(), l[j].LastMessage()
+	return a != nil && (b == nil || a.Date.After(b.Date))
+}
+
+// A Store keeps conversations of all devices, and saves them in a directory
+// with one file per device.
+type Store struct {
+	dir string
+
+	locker      sync.Mutex
+	devices     map[string][]*Conversation
+	subscribers []chan string
+}
+
+func (s *Store) filename(deviceId string) string {
+	return filepath.Join(s.dir, strings.Replace(deviceId, "/", "_", -1)+".json")
+}
+
+func (s *Store) load(deviceId string) []*Conversation {
+	if convs, ok := s.devices[deviceId]; ok {
+		return convs
+	}
+
+	var convs []*Conversation
+	if s.dir != "" {
+		var err error
+		convs, err = s.read(deviceId)
+		if err != nil {
+			log.Println("Cannot load conversations:", err)
+
+			// Keep the broken file aside, it would be overwritten on next save
+			name := s.filename(deviceId)
+			if err := os.Rename(name, name+".broken"); err != nil {
+				log.Println("Cannot rename broken conversations file:", err)
+			}
+		}
+	}
+
+	s.devices[deviceId] = convs
+	return convs
+}
+
+func (s *Store) read(deviceId string) ([]*Conversation, error) {
+	f, err := os.Open(s.filename(deviceId))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var convs []*Conversation
+	if err := json.NewDecoder(f).Decode(&convs); err != nil {
+		return nil, err
+	}
+	return convs, nil
+}
+
+// save writes the conversations of a device. The file is replaced atomically,
+// so that it isn't left half-written on crash.
+func (s *Store) save(deviceId string) error {
+	if s.dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(s.dir, ".conversations")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := json.NewEncoder(f).Encode(s.devices[deviceId]); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), s.filename(deviceId))
+}
+
+// Add appends messages to the conversations of a device. Messages already in
+// the store are ignored.
+func (s *Store) Add(deviceId string, messages ...*Message) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	convs := s.load(deviceId)
+
+	changed := false
+	for _, m := range messages {
+		var conv *Conversation
+		for _, c := range convs {
+			if (m.ThreadId != 0 && c.ThreadId == m.ThreadId) || contacts.MatchNumbers(c.Address, m.Address) {
+				conv = c
+				break
+			}
+		}
+		if conv == nil {
+			conv = &Conversation{Address: m.Address}
+			convs = append(convs, conv)
+		}
+
+		if conv.add(m) {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	s.devices[deviceId] = convs
+
+	for _, ch := range s.subscribers {
+		select {
+		case ch <- deviceId:
+		default:
+			// Don't block on slow subscribers
+		}
+	}
+
+	return s.save(deviceId)
+}
+
+// Conversations returns the conversations of a device, most recent first.
+func (s *Store) Conversations(deviceId string) []Conversation {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	convs := s.load(deviceId)
+
+	l := make([]Conversation, len(convs))
+	for i, c := range convs {
+		l[i] = *c
+		l[i].Messages = make([]*Message, len(c.Messages))
+		for j, m := range c.Messages {
+			msg := *m
+			l[i].Messages[j] = &msg
+		}
+	}
+
+	sort.Sort(byLastMessage(l))
+	return l
+}
+
+// Subscribe returns a channel receiving the ID of devices whose conversations
+// have changed.
+func (s *Store) Subscribe() <-chan string {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	ch := make(chan string, 16)
+	s.subscribers = append(s.subscribers, ch)
+	return ch
+}
+
+// Unsubscribe stops sending updates to a channel returned by Subscribe.
+func (s *Store) Unsubscribe(ch <-chan string) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	for i, sub := range s.subscribers {
+		if sub == ch {
+			s.subscribers = append(s.subscribers[:i], s.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+// NewStore creates a store saving conversations in dir. If dir is empty,
+// conversations are only kept in memory.
+func NewStore(dir string) *Store {
+	return &Store{
+		dir:     dir,
+		devices: map[string][]*Conversation{},
+	}
+}
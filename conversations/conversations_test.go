@@ -0,0 +1,126 @@
+package conversations
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore_Add(t *testing.T) {
+	s := NewStore("")
+	now := time.Now()
+
+	// Received from a telephony event, without remote ID
+	err := s.Add("a", &Message{Address: "+33 6 12 34 56 78", Body: "Hello", Date: now})
+	if err != nil {
+		t.Fatal("Expected no error when adding a message, got", err)
+	}
+
+	// The same message synchronized from the device
+	err = s.Add("a", &Message{Id: 42, ThreadId: 1, Address: "0612345678", Body: "Hello", Date: now.Add(time.Second)})
+	if err != nil {
+		t.Fatal("Expected no error when adding a message, got", err)
+	}
+
+	convs := s.Conversations("a")
+	if len(convs) != 1 {
+		t.Fatal("Expected a single conversation, got", len(convs))
+	}
+	if len(convs[0].Messages) != 1 {
+		t.Fatal("Expected the messages to be merged, got", len(convs[0].Messages))
+	}
+	if convs[0].Messages[0].Id != 42 {
+		t.Fatal("Expected the merged message to get the remote ID, got", convs[0].Messages[0].Id)
+	}
+
+	// Synchronized again
+	s.Add("a", &Message{Id: 42, ThreadId: 1, Address: "0612345678", Body: "Hello", Date: now})
+	if convs := s.Conversations("a"); len(convs[0].Messages) != 1 {
+		t.Fatal("Expected known messages to be ignored, got", len(convs[0].Messages))
+	}
+
+	// Conversations are per device
+	if convs := s.Conversations("b"); len(convs) != 0 {
+		t.Fatal("Expected no conversation for another device, got", len(convs))
+	}
+}
+
+func TestStore_Add_repeated(t *testing.T) {
+	s := NewStore("")
+	now := time.Now()
+
+	// The same text received twice from telephony events
+	s.Add("a", &Message{Address: "0612345678", Body: "ok", Date: now})
+	s.Add("a", &Message{Address: "0612345678", Body: "ok", Date: now.Add(30 * time.Second)})
+
+	convs := s.Conversations("a")
+	if len(convs) != 1 || len(convs[0].Messages) != 2 {
+		t.Fatalf("Expected both messages to be kept, got %+v", convs)
+	}
+
+	// Messages with different remote IDs are never merged
+	s.Add("b", &Message{Id: 1, Address: "0612345678", Body: "ok", Date: now})
+	s.Add("b", &Message{Id: 2, Address: "0612345678", Body: "ok", Date: now})
+	if convs := s.Conversations("b"); len(convs[0].Messages) != 2 {
+		t.Fatal("Expected both messages to be kept, got", len(convs[0].Messages))
+	}
+}
+
+func TestStore_save(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gnomeconnect-conversations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	date := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	s := NewStore(dir)
+	err = s.Add("a/b", &Message{Id: 1, ThreadId: 2, Address: "0612345678", Body: "Hello", Date: date})
+	if err != nil {
+		t.Fatal("Expected no error when adding a message, got", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "a_b.json")); err != nil {
+		t.Fatal("Expected the conversations to be saved:", err)
+	}
+
+	convs := NewStore(dir).Conversations("a/b")
+	if len(convs) != 1 || len(convs[0].Messages) != 1 {
+		t.Fatalf("Expected the conversations to be loaded, got %+v", convs)
+	}
+	m := convs[0].Messages[0]
+	if m.Id != 1 || m.ThreadId != 2 || m.Body != "Hello" || !m.Date.Equal(date) {
+		t.Fatalf("Invalid loaded message: %+v", m)
+	}
+}
+
+func TestStore_load_broken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gnomeconnect-conversations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "a.json")
+	if err := ioutil.WriteFile(name, []byte("[{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewStore(dir)
+	if convs := s.Conversations("a"); len(convs) != 0 {
+		t.Fatal("Expected no conversation, got", len(convs))
+	}
+	if _, err := os.Stat(name + ".broken"); err != nil {
+		t.Fatal("Expected the broken file to be kept aside:", err)
+	}
+
+	// The store is still usable
+	if err := s.Add("a", &Message{Address: "0612345678", Body: "Hello", Date: time.Now()}); err != nil {
+		t.Fatal("Expected no error when adding a message, got", err)
+	}
+	if convs := NewStore(dir).Conversations("a"); len(convs) != 1 {
+		t.Fatal("Expected the conversations to be saved, got", len(convs))
+	}
+}
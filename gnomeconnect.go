@@ -1,34 +1,72 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"github.com/emersion/gnomeconnect/contacts"
+	"github.com/emersion/gnomeconnect/conversations"
+	"github.com/emersion/gnomeconnect/handlers"
+	"github.com/emersion/gnomeconnect/payload"
+	"github.com/emersion/gnomeconnect/plugins"
+	"github.com/emersion/gnomeconnect/service"
 	"github.com/emersion/gnomeconnect/ui"
 	"github.com/emersion/gnomeconnect/utils"
 	"github.com/emersion/go-kdeconnect/engine"
 	"github.com/emersion/go-kdeconnect/network"
 	"github.com/emersion/go-kdeconnect/plugin"
-	"github.com/emersion/go-mpris"
 	"github.com/esiqveland/notify"
 	"github.com/godbus/dbus"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 )
 
-func newNotification() notify.Notification {
-	return notify.Notification{
-		AppName: "GNOMEConnect",
-		Hints: map[string]dbus.Variant{
-			"desktop-entry": dbus.MakeVariant("gnomeconnect"),
-		},
-	}
+// Arguments of the first instance are dropped if their device doesn't join
+// during this delay.
+const pendingArgsTimeout = time.Minute
+
+// parseActivateArgs parses the command-line arguments of an instance. Files
+// are sent to the device, if any.
+func parseActivateArgs(args []string) (device string, files []string, err error) {
+	fs := flag.NewFlagSet("gnomeconnect", flag.ContinueOnError)
+	fs.StringVar(&device, "device", "", "")
+	err = fs.Parse(args)
+	files = fs.Args()
+	return
 }
 
 func main() {
-	err := utils.CreateLockFile()
+	args := os.Args[1:]
+	if isCli(args) {
+		os.Exit(runCli(args))
+	}
+	_, files, err := parseActivateArgs(args)
 	if err != nil {
-		utils.NotifyLockingPid()
-		log.Fatal("Cannot create lock file:", err)
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(1)
+	}
+
+	// The running instance may have another working directory
+	for i, file := range files {
+		if abs, err := filepath.Abs(file); err == nil {
+			args[len(args)-len(files)+i] = abs
+		}
+	}
+
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		panic(err)
+	}
+
+	// If another instance is running, let it handle our arguments
+	if ok, err := service.Activate(conn, args); ok {
+		return
+	} else if err != nil {
+		log.Println("Warning: cannot contact running instance:", err)
 	}
 
 	config := engine.DefaultConfig()
@@ -48,185 +86,47 @@ func main() {
 	}
 	config.KnownDevices = knownDevices
 
+	settings, err := utils.LoadSettings()
+	if err != nil {
+		log.Println("Warning: error while loading settings:", err)
+	}
+
+	cert, err := utils.LoadCertificate()
+	if err != nil {
+		log.Fatal("Could not get certificate:", err)
+	}
+	payloadConfig := payload.NewConfig(cert)
+
 	battery := plugin.NewBattery()
 	ping := plugin.NewPing()
-	notification := plugin.NewNotification()
-	mprisPlugin := plugin.NewMpris()
+	notification := plugins.NewNotification()
+	mprisPlugin := plugins.NewMpris(payloadConfig)
 	telephony := plugin.NewTelephony()
 	sftp := plugin.NewSftp()
-
-	conn, err := dbus.SessionBus()
-	if err != nil {
-		panic(err)
-	}
+	sms := plugins.NewSms()
+	share := plugins.NewShare(payloadConfig)
+	clipboard := plugins.NewClipboard()
+	findMyPhone := plugins.NewFindMyPhone()
+	runCommand := plugins.NewRunCommand()
 
 	notifier, err := notify.New(conn)
 	if err != nil {
 		panic(err)
 	}
 
-	go (func() {
-		notificationsMap := map[string]int{}
-		var callNotification int
-		var batteryNotification int
-
-		for {
-			select {
-			case event := <-ping.Incoming:
-				log.Println("Ping:", event.Device.Name)
-
-				n := newNotification()
-				n.AppIcon = utils.GetDeviceIcon(event.Device)
-				n.Summary = "Ping from " + event.Device.Name
-				notifier.SendNotification(n)
-			case event := <-battery.Incoming:
-				log.Println("Battery:", event.Device.Name, event.BatteryBody)
-
-				if event.ThresholdEvent == plugin.BatteryThresholdEventLow {
-					n := newNotification()
-					n.AppIcon = "battery-caution"
-					n.Summary = event.Device.Name + " has low battery"
-					id, _ := notifier.SendNotification(n)
-					batteryNotification = int(id)
-				}
-
-				if event.IsCharging {
-					if batteryNotification != 0 {
-						notifier.CloseNotification(batteryNotification)
-						batteryNotification = 0
-					}
-				}
-			case event := <-notification.Incoming:
-				log.Println("Notification:", event.Device.Name, event.NotificationBody)
-
-				id, exists := notificationsMap[event.NotificationBody.Id]
-
-				if event.IsCancel {
-					if exists {
-						notifier.CloseNotification(id)
-					}
-					break
-				}
-
-				n := newNotification()
-				n.AppIcon = utils.GetDeviceIcon(event.Device)
-				n.Summary = "Notification from " + event.AppName + " on " + event.Device.Name
-				n.Body = event.Ticker
-				if exists {
-					n.ReplacesID = uint32(id)
-				}
-				newId, _ := notifier.SendNotification(n)
-
-				notificationsMap[event.NotificationBody.Id] = int(newId)
-
-				// TODO: wait for notification dismiss and send message to remote
-			case event := <-mprisPlugin.Incoming:
-				log.Println("Mpris:", event.Device.Name, event.MprisBody)
-
-				if event.RequestPlayerList {
-					names, err := mpris.List(conn)
-					if err != nil {
-						log.Println("Warning: cannot list available MPRIS players", err)
-						break
-					}
-
-					mprisPlugin.SendPlayerList(event.Device, names)
-				}
-
-				if event.Player != "" {
-					player := mpris.New(conn, event.Player)
-
-					event.RequestNowPlaying = true
-					switch event.Action {
-					case "Next":
-						player.Next()
-					case "Previous":
-						player.Previous()
-					case "Pause":
-						player.Pause()
-					case "PlayPause":
-						player.PlayPause()
-					case "Stop":
-						player.Stop()
-					case "Play":
-						player.Play()
-					default:
-						event.RequestNowPlaying = false
-					}
-
-					if event.SetVolume != 0 {
-						player.SetVolume(float64(event.SetVolume) / 100)
-						event.RequestVolume = true
-					}
-
-					if event.RequestNowPlaying || event.RequestVolume {
-						reply := &plugin.MprisBody{}
-						if event.RequestNowPlaying {
-							metadata := player.GetMetadata()
-							reply.NowPlaying = metadata["xesam:title"].String()
-							reply.IsPlaying = (player.GetPlaybackStatus() == "Playing")
-							reply.Length = float64(metadata["mpris:length"].Value().(int64)) / 1000
-							reply.Pos = float64(player.GetPosition()) / 1000
-						}
-						if event.RequestVolume {
-							reply.Volume = int(player.GetVolume() * 100)
-						}
-						event.Device.Send(plugin.MprisType, reply)
-					}
-				}
-			case event := <-telephony.Incoming:
-				log.Println("Telephony:", event.Device.Name, event.TelephonyBody)
+	desktopNotifier := handlers.NewDesktopNotifier(notifier)
 
-				contactName := event.PhoneNumber
-				if contactName == "" {
-					contactName = event.PhoneNumber
-				}
-
-				if event.TelephonyBody.Event == plugin.TelephonySms {
-					n := newNotification()
-					n.AppIcon = utils.GetDeviceIcon(event.Device)
-					n.Hints["category"] = dbus.MakeVariant("im.received")
-					n.Summary = "SMS from " + contactName + " on " + event.Device.Name
-					n.Body = event.MessageBody
-					notifier.SendNotification(n)
-					break
-				}
-
-				if event.IsCancel {
-					if callNotification != 0 {
-						notifier.CloseNotification(callNotification)
-						callNotification = 0
-					}
-					break
-				}
-
-				n := newNotification()
-				n.Hints["category"] = dbus.MakeVariant("im")
-				if callNotification != 0 {
-					n.ReplacesID = uint32(callNotification)
-				}
-
-				switch event.TelephonyBody.Event {
-				case plugin.TelephonyRinging:
-					n.AppIcon = "call-start"
-					n.Summary = "Call from " + contactName + " on " + event.Device.Name
-				case plugin.TelephonyTalking:
-					n.AppIcon = "call-start"
-					n.Summary = "Calling " + contactName + " on " + event.Device.Name
-				case plugin.TelephonyMissedCall:
-					n.AppIcon = "call-stop"
-					n.Summary = "Missed call from " + contactName + " on " + event.Device.Name
-				}
-
-				id, _ := notifier.SendNotification(n)
-				callNotification = int(id)
-			case event := <-sftp.Incoming:
-				log.Println("Sftp:", event.Device.Name, event.SftpBody)
+	contactsDir, err := utils.GetContactsDir()
+	if err != nil {
+		log.Println("Warning: cannot get contacts directory:", err)
+	}
+	resolver := contacts.NewResolver(contacts.VCardDir(contactsDir), contacts.NewEDS(conn))
 
-				utils.MountSftp(event.Ip, event.Port, event.User, event.Password)
-			}
-		}
-	})()
+	conversationsDir, err := utils.GetConversationsDir()
+	if err != nil {
+		log.Println("Warning: cannot get conversations directory:", err)
+	}
+	store := conversations.NewStore(conversationsDir)
 
 	hdlr := plugin.NewHandler()
 	hdlr.Register(battery)
@@ -235,25 +135,73 @@ func main() {
 	hdlr.Register(mprisPlugin)
 	hdlr.Register(telephony)
 	hdlr.Register(sftp)
+	hdlr.Register(sms)
+	hdlr.Register(share)
+	hdlr.Register(clipboard)
+	hdlr.Register(findMyPhone)
+	hdlr.Register(runCommand)
+
+	batteryHandler := handlers.NewBattery(battery, desktopNotifier, settings)
+
+	shareHandler := handlers.NewShare(share, desktopNotifier, settings, ui.SetClipboardText)
+
+	telephonyHandler := handlers.NewTelephony(telephony, desktopNotifier, resolver, store, ui.ShowReplyDialog)
+	telephonyHandler.Observe(handlers.NewCallMedia(conn, settings))
+
+	reactions := handlers.NewRegistry()
+	reactions.Register(batteryHandler)
+	reactions.Register(handlers.NewPing(ping, desktopNotifier))
+	reactions.Register(handlers.NewNotification(notification, desktopNotifier, ui.ShowReplyDialog))
+	reactions.Register(handlers.NewMpris(mprisPlugin, conn))
+	reactions.Register(telephonyHandler)
+	reactions.Register(handlers.NewSftp(sftp))
+	reactions.Register(handlers.NewSms(sms, store))
+	reactions.Register(shareHandler)
+	reactions.Register(handlers.NewClipboard(clipboard, settings, ui.SetClipboardText, ui.WatchClipboard))
+	reactions.Register(handlers.NewFindMyPhone(findMyPhone, desktopNotifier, utils.NewSoundPlayer(handlers.FindMyPhoneSound)))
+	reactions.Register(handlers.NewRunCommand(runCommand, desktopNotifier))
+	reactions.Start()
 
 	e := engine.New(hdlr, config)
 
+	srv, err := service.New(conn, e, &service.Plugins{
+		Ping:    ping,
+		Sftp:    sftp,
+		Battery: batteryHandler,
+		Store:   store,
+		Share:   shareHandler,
+	})
+	if err == service.ErrNameTaken {
+		// Another instance has just been started
+		service.Activate(conn, args)
+		return
+	} else if err != nil {
+		log.Fatal("Cannot export D-Bus service:", err)
+	}
+
 	var i *ui.Ui
 
 	go (func() {
 		devices := map[string]*network.Device{}
 		notifications := map[string]int{}
 
-		closed := notifier.NotificationClosed()
-		actions := notifier.ActionInvoked()
+		closed := desktopNotifier.Closed
+		actions := desktopNotifier.Actions
 
 		sigs := make(chan os.Signal, 1)
-		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
 		startUi := func() {
 			if i == nil {
 				plugins := &ui.PluginCollection{
-					Sftp: sftp,
+					Ping:     ping,
+					Sftp:     sftp,
+					Battery:  batteryHandler,
+					Contacts: resolver,
+					Sms:      sms,
+					Store:    store,
+					Share:    shareHandler,
+					Settings: settings,
 				}
 
 				i = ui.New(e, plugins)
@@ -288,16 +236,60 @@ func main() {
 			return nil
 		}
 
+		findDevice := func(name string) *network.Device {
+			if device, ok := devices[name]; ok {
+				return device
+			}
+			for _, device := range devices {
+				if strings.EqualFold(device.Name, name) {
+					return device
+				}
+			}
+			return nil
+		}
+
+		// handleArgs opens the window on the device designated by args, and
+		// sends files to it. It returns false if the device isn't available.
+		handleArgs := func(args []string) bool {
+			deviceName, files, _ := parseActivateArgs(args)
+			if deviceName == "" {
+				return true
+			}
+			device := findDevice(deviceName)
+			if device == nil {
+				return false
+			}
+
+			startUi()
+			i.SelectDevice(device)
+
+			for _, file := range files {
+				if err := shareHandler.SendFile(device, file); err != nil {
+					log.Println("Cannot send file:", err)
+				}
+			}
+			return true
+		}
+
+		// Our own arguments are handled when their device joins
+		var pendingArgs []string
+		var pendingTimeout <-chan time.Time
+		if deviceName, _, _ := parseActivateArgs(args); deviceName != "" {
+			log.Println("Waiting for device:", deviceName)
+			pendingArgs = args
+			pendingTimeout = time.After(pendingArgsTimeout)
+		}
+
 		deviceAvailable := func(device *network.Device) {
-			n := newNotification()
+			n := handlers.NewNotification()
 			n.AppIcon = utils.GetDeviceIcon(device)
 			n.Summary = device.Name
 			n.Body = "New device available"
 			n.Hints["category"] = dbus.MakeVariant("device")
 			n.Actions = []string{"pair", "Pair device"}
-			id, _ := notifier.SendNotification(n)
+			id, _ := desktopNotifier.Send(n, nil)
 
-			notifications[device.Id] = int(id)
+			notifications[device.Id] = id
 
 			if i != nil {
 				i.Available <- device
@@ -305,28 +297,30 @@ func main() {
 		}
 
 		deviceRequestsPairing := func(device *network.Device) {
-			n := newNotification()
+			n := handlers.NewNotification()
 			n.AppIcon = utils.GetDeviceIcon(device)
 			n.Summary = device.Name
 			n.Body = "New pair request"
 			n.Hints["category"] = dbus.MakeVariant("device")
 			n.Actions = []string{"pair", "Accept", "unpair", "Reject"}
-			id, _ := notifier.SendNotification(n)
+			id, _ := desktopNotifier.Send(n, nil)
 
-			notifications[device.Id] = int(id)
+			notifications[device.Id] = id
 		}
 
 		deviceConnected := func(device *network.Device) {
-			n := newNotification()
+			n := handlers.NewNotification()
 			n.AppIcon = utils.GetDeviceIcon(device)
 			n.Summary = device.Name
 			n.Body = "Device connected"
 			n.Hints["resident"] = dbus.MakeVariant(true)
 			n.Hints["category"] = dbus.MakeVariant("device.added")
 			n.Actions = []string{"default", "Open"}
-			id, _ := notifier.SendNotification(n)
+			id, _ := desktopNotifier.Send(n, nil)
+
+			notifications[device.Id] = id
 
-			notifications[device.Id] = int(id)
+			reactions.DeviceConnected(device)
 
 			if i != nil {
 				i.Connected <- device
@@ -334,9 +328,11 @@ func main() {
 		}
 
 		cleanup := func() {
+			reactions.Stop()
+
 			// Close all notifications
 			for _, id := range notifications {
-				notifier.CloseNotification(id)
+				desktopNotifier.Close(id)
 			}
 		}
 
@@ -348,21 +344,31 @@ func main() {
 				}
 
 				devices[device.Id] = device
+				srv.DeviceJoined(device)
 
 				if device.Paired {
 					deviceConnected(device)
 				} else {
 					deviceAvailable(device)
 				}
+
+				if pendingArgs != nil && handleArgs(pendingArgs) {
+					pendingArgs = nil
+				}
+			case <-pendingTimeout:
+				if pendingArgs != nil {
+					log.Println("Warning: device not found, ignoring arguments:", pendingArgs)
+					pendingArgs = nil
+				}
 			case device := <-e.RequestsPairing:
 				if id, ok := notifications[device.Id]; ok {
-					notifier.CloseNotification(id)
+					desktopNotifier.Close(id)
 				}
 
 				deviceRequestsPairing(device)
 			case device := <-e.Paired:
 				if id, ok := notifications[device.Id]; ok {
-					notifier.CloseNotification(id)
+					desktopNotifier.Close(id)
 				}
 
 				err := utils.SaveKnownDevices(config.KnownDevices)
@@ -370,23 +376,31 @@ func main() {
 					log.Println("Cannot save known devices:", err)
 				}
 
+				srv.DeviceChanged(device)
+
 				deviceConnected(device)
 			case device := <-e.Unpaired:
 				if id, ok := notifications[device.Id]; ok {
-					notifier.CloseNotification(id)
+					desktopNotifier.Close(id)
 				}
 
+				reactions.DeviceDisconnected(device)
+				srv.DeviceChanged(device)
+
 				if i != nil {
 					i.Disconnected <- device
 				}
 			case device := <-e.Leaves:
 				if id, ok := notifications[device.Id]; ok {
-					notifier.CloseNotification(id)
+					desktopNotifier.Close(id)
 				}
 				if _, ok := devices[device.Id]; ok {
 					delete(devices, device.Id)
 				}
 
+				reactions.DeviceDisconnected(device)
+				srv.DeviceLeft(device)
+
 				if i != nil {
 					i.Unavailable <- device
 				}
@@ -424,24 +438,28 @@ func main() {
 						//device.Close()
 					}
 				}
-			case signal := <-sigs:
-				if signal == syscall.SIGUSR1 {
-					// Restore device notifications
-					for _, device := range devices {
-						if !device.Paired {
-							continue
-						}
-						if _, ok := notifications[device.Id]; !ok {
-							deviceConnected(device)
-						}
+			case args := <-srv.Activated:
+				log.Println("Activated:", args)
+
+				// Restore device notifications
+				for _, device := range devices {
+					if !device.Paired {
+						continue
+					}
+					if _, ok := notifications[device.Id]; !ok {
+						deviceConnected(device)
 					}
+				}
 
-					startUi()
-				} else {
-					// Interrupt signal received
-					cleanup()
-					os.Exit(0)
+				startUi()
+
+				if !handleArgs(args) {
+					log.Println("Cannot find device, ignoring arguments:", args)
 				}
+			case <-sigs:
+				// Interrupt signal received
+				cleanup()
+				os.Exit(0)
 			}
 		}
 	})()
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"github.com/emersion/gnomeconnect/plugins"
+	"github.com/emersion/gnomeconnect/utils"
+	"github.com/emersion/go-kdeconnect/network"
+	"github.com/emersion/go-kdeconnect/plugin"
+	"log"
+	"strconv"
+)
+
+// BatteryState is the latest known battery state of a device.
+type BatteryState struct {
+	Charge         int
+	IsCharging     bool
+	ThresholdEvent int
+}
+
+type BatteryUpdate struct {
+	Device *network.Device
+	BatteryState
+}
+
+type batteryDevice struct {
+	state        BatteryState
+	notification int
+}
+
+type Battery struct {
+	base
+	plugin   *plugin.Battery
+	notifier Notifier
+	settings *utils.Settings
+
+	devices     map[string]*batteryDevice
+	subscribers []chan *BatteryUpdate
+}
+
+func (h *Battery) Name() string {
+	return "battery"
+}
+
+func (h *Battery) Start() {
+	h.start(h.listen)
+}
+
+func (h *Battery) Stop() {
+	h.stop(func() {
+		for _, d := range h.devices {
+			h.closeNotification(d)
+		}
+	})
+}
+
+func (h *Battery) listen() {
+	for event := range h.plugin.Incoming {
+		h.Lock()
+		if h.enabled {
+			h.handle(event)
+		}
+		h.Unlock()
+	}
+}
+
+func (h *Battery) closeNotification(d *batteryDevice) {
+	if d.notification != 0 {
+		h.notifier.Close(d.notification)
+		d.notification = 0
+	}
+}
+
+func (h *Battery) notify(d *batteryDevice, icon, summary string) {
+	n := NewNotification()
+	n.AppIcon = icon
+	n.Summary = summary
+	if d.notification != 0 {
+		n.ReplacesID = uint32(d.notification)
+	}
+	id, _ := h.notifier.Send(n, nil)
+	d.notification = id
+}
+
+func (h *Battery) handle(event *plugin.BatteryEvent) {
+	log.Println("Battery:", event.Device.Name, event.BatteryBody)
+
+	d, ok := h.devices[event.Device.Id]
+	if !ok {
+		d = &batteryDevice{}
+		h.devices[event.Device.Id] = d
+	}
+
+	previous := d.state
+	d.state = BatteryState{
+		Charge:         event.CurrentCharge,
+		IsCharging:     event.IsCharging,
+		ThresholdEvent: event.ThresholdEvent,
+	}
+
+	if event.ThresholdEvent == plugin.BatteryThresholdEventLow && !event.IsCharging {
+		h.notify(d, "battery-caution", event.Device.Name+" has low battery ("+strconv.Itoa(event.CurrentCharge)+"%)")
+	} else if event.IsCharging && event.CurrentCharge >= 100 && (!ok || previous.Charge < 100) {
+		if h.settings.Device(event.Device.Id).NotifyFullyCharged {
+			h.notify(d, "battery-full-charged", event.Device.Name+" is fully charged")
+		}
+	} else if event.IsCharging != previous.IsCharging {
+		// Plugged or unplugged, previous notifications are outdated
+		h.closeNotification(d)
+	}
+
+	update := &BatteryUpdate{
+		Device:       event.Device,
+		BatteryState: d.state,
+	}
+	for _, ch := range h.subscribers {
+		select {
+		case ch <- update:
+		default:
+			// Don't block on slow subscribers
+		}
+	}
+}
+
+// State returns the latest battery state of a device. ok is false if the
+// device hasn't sent its battery state yet.
+func (h *Battery) State(deviceId string) (state BatteryState, ok bool) {
+	h.Lock()
+	defer h.Unlock()
+
+	d, ok := h.devices[deviceId]
+	if !ok {
+		return
+	}
+	return d.state, true
+}
+
+// Subscribe returns a channel receiving battery state updates for all devices.
+func (h *Battery) Subscribe() <-chan *BatteryUpdate {
+	h.Lock()
+	defer h.Unlock()
+
+	ch := make(chan *BatteryUpdate, 16)
+	h.subscribers = append(h.subscribers, ch)
+	return ch
+}
+
+// Unsubscribe stops sending updates to a channel returned by Subscribe.
+func (h *Battery) Unsubscribe(ch <-chan *BatteryUpdate) {
+	h.Lock()
+	defer h.Unlock()
+
+	for i, sub := range h.subscribers {
+		if sub == ch {
+			h.subscribers = append(h.subscribers[:i], h.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Request asks a device to send its current battery state.
+func (h *Battery) Request(device *network.Device) error {
+	return plugins.SendBatteryRequest(device)
+}
+
+func NewBattery(p *plugin.Battery, notifier Notifier, settings *utils.Settings) *Battery {
+	return &Battery{
+		plugin:   p,
+		notifier: notifier,
+		settings: settings,
+		devices:  map[string]*batteryDevice{},
+	}
+}
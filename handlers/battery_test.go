@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"github.com/emersion/gnomeconnect/utils"
+	"github.com/emersion/go-kdeconnect/network"
+	"github.com/emersion/go-kdeconnect/plugin"
+	"testing"
+)
+
+func batteryEvent(device *network.Device, charge int, charging bool, threshold int) *plugin.BatteryEvent {
+	return &plugin.BatteryEvent{
+		Event: plugin.Event{Device: device},
+		BatteryBody: plugin.BatteryBody{
+			CurrentCharge:  charge,
+			IsCharging:     charging,
+			ThresholdEvent: threshold,
+		},
+	}
+}
+
+func newTestBattery() (*Battery, *fakeNotifier, *utils.Settings) {
+	notifier := newFakeNotifier()
+	settings := &utils.Settings{Devices: map[string]*utils.DeviceSettings{}}
+	return NewBattery(plugin.NewBattery(), notifier, settings), notifier, settings
+}
+
+func TestBattery_low(t *testing.T) {
+	h, notifier, _ := newTestBattery()
+	device := newTestDevice("a")
+
+	h.handle(batteryEvent(device, 14, false, plugin.BatteryThresholdEventLow))
+	if notifier.count() != 1 {
+		t.Fatal("Expected a low battery notification, got", notifier.count())
+	}
+
+	// A second low battery event replaces the notification
+	h.handle(batteryEvent(device, 10, false, plugin.BatteryThresholdEventLow))
+	if notifier.count() != 1 {
+		t.Fatal("Expected the low battery notification to be replaced, got", notifier.count())
+	}
+
+	// Plugging the device in makes the notification outdated
+	h.handle(batteryEvent(device, 10, true, 0))
+	if notifier.count() != 0 {
+		t.Fatal("Expected the notification to be closed after plugging in")
+	}
+
+	state, ok := h.State(device.Id)
+	if !ok {
+		t.Fatal("Expected a battery state")
+	}
+	if state.Charge != 10 || !state.IsCharging {
+		t.Fatalf("Invalid battery state: %+v", state)
+	}
+}
+
+func TestBattery_fullyCharged(t *testing.T) {
+	h, notifier, settings := newTestBattery()
+	silent := newTestDevice("silent")
+	noisy := newTestDevice("noisy")
+	settings.SetDevice(noisy.Id, utils.DeviceSettings{NotifyFullyCharged: true})
+
+	h.handle(batteryEvent(silent, 99, true, 0))
+	h.handle(batteryEvent(silent, 100, true, 0))
+	if notifier.count() != 0 {
+		t.Fatal("Expected no notification when the setting is disabled")
+	}
+
+	h.handle(batteryEvent(noisy, 99, true, 0))
+	h.handle(batteryEvent(noisy, 100, true, 0))
+	if notifier.count() != 1 {
+		t.Fatal("Expected a fully charged notification, got", notifier.count())
+	}
+
+	// Staying at 100% doesn't notify again
+	sent := notifier.sent
+	h.handle(batteryEvent(noisy, 100, true, 0))
+	if notifier.sent != sent {
+		t.Fatal("Expected no new notification while staying fully charged")
+	}
+
+	// Unplugging closes it
+	h.handle(batteryEvent(noisy, 100, false, 0))
+	if notifier.count() != 0 {
+		t.Fatal("Expected the notification to be closed after unplugging")
+	}
+}
+
+func TestBattery_subscribe(t *testing.T) {
+	h, _, _ := newTestBattery()
+	device := newTestDevice("a")
+
+	ch := h.Subscribe()
+	h.handle(batteryEvent(device, 42, false, 0))
+
+	select {
+	case update := <-ch:
+		if update.Device != device || update.Charge != 42 {
+			t.Fatalf("Invalid battery update: %+v", update)
+		}
+	default:
+		t.Fatal("Expected a battery update")
+	}
+
+	h.Unsubscribe(ch)
+	h.handle(batteryEvent(device, 41, false, 0))
+
+	select {
+	case <-ch:
+		t.Fatal("Expected no update after unsubscribing")
+	default:
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"github.com/emersion/gnomeconnect/utils"
+	"github.com/emersion/go-mpris"
+	"github.com/godbus/dbus"
+	"log"
+	"sync"
+)
+
+// CallMedia pauses media players and mutes the desktop during calls, and
+// restores them when all calls have ended.
+type CallMedia struct {
+	conn     *dbus.Conn
+	settings *utils.Settings
+
+	locker sync.Mutex
+	// Calls during which media is paused
+	calls map[*Call]bool
+	// Players paused by us
+	paused []string
+	// Whether the desktop has been muted by us
+	muted bool
+}
+
+func (m *CallMedia) pause() {
+	names, err := mpris.List(m.conn)
+	if err != nil {
+		log.Println("Warning: cannot list available MPRIS players", err)
+		return
+	}
+
+	for _, name := range names {
+		player := mpris.New(m.conn, name)
+		if player.GetPlaybackStatus() != "Playing" {
+			continue
+		}
+
+		player.Pause()
+		m.paused = append(m.paused, name)
+	}
+}
+
+func (m *CallMedia) resume() {
+	for _, name := range m.paused {
+		mpris.New(m.conn, name).Play()
+	}
+	m.paused = nil
+}
+
+func (m *CallMedia) CallStarted(call *Call) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	ds := m.settings.Device(call.Device.Id)
+	if !ds.PauseMediaOnCall && !ds.MuteOnCall {
+		return
+	}
+
+	m.calls[call] = true
+
+	if ds.PauseMediaOnCall && len(m.paused) == 0 {
+		m.pause()
+	}
+
+	if ds.MuteOnCall && !m.muted {
+		if muted, err := utils.IsAudioMuted(); err != nil {
+			log.Println("Cannot get audio mute state:", err)
+		} else if !muted {
+			if err := utils.MuteAudio(true); err != nil {
+				log.Println("Cannot mute audio:", err)
+			} else {
+				m.muted = true
+			}
+		}
+	}
+}
+
+func (m *CallMedia) CallEnded(call *Call) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	if !m.calls[call] {
+		return
+	}
+
+	delete(m.calls, call)
+	if len(m.calls) > 0 {
+		return
+	}
+
+	m.resume()
+
+	if m.muted {
+		if err := utils.MuteAudio(false); err != nil {
+			log.Println("Cannot unmute audio:", err)
+		}
+		m.muted = false
+	}
+}
+
+func NewCallMedia(conn *dbus.Conn, settings *utils.Settings) *CallMedia {
+	return &CallMedia{
+		conn:     conn,
+		settings: settings,
+		calls:    map[*Call]bool{},
+	}
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"github.com/emersion/gnomeconnect/plugins"
+	"github.com/emersion/gnomeconnect/utils"
+	"github.com/emersion/go-kdeconnect/network"
+	"log"
+	"time"
+)
+
+// A WatchClipboardFunc calls changed with the new text each time the content
+// of the clipboard changes. It must not block, and changed must not be called
+// from the UI thread.
+type WatchClipboardFunc func(changed func(text string))
+
+// Clipboard synchronizes the desktop clipboard with devices which have
+// clipboard synchronization enabled in their settings.
+type Clipboard struct {
+	base
+	plugin    *plugins.Clipboard
+	settings  *utils.Settings
+	clipboard ClipboardFunc
+	watch     WatchClipboardFunc
+
+	devices devices
+	// The last known content of the clipboard. Changes to the same content are
+	// ignored, so that content received from a device isn't sent back.
+	content string
+	// When content last changed
+	updated time.Time
+}
+
+func (h *Clipboard) Name() string {
+	return "clipboard"
+}
+
+func (h *Clipboard) Start() {
+	h.start(h.listen)
+}
+
+func (h *Clipboard) Stop() {
+	h.stop(nil)
+}
+
+func (h *Clipboard) DeviceConnected(device *network.Device) {
+	h.Lock()
+	defer h.Unlock()
+	h.devices.DeviceConnected(device)
+
+	// The device also sends its clipboard when connecting, the most recent
+	// one is kept by both sides
+	if h.enabled && h.content != "" && h.settings.Device(device.Id).SyncClipboard {
+		if err := h.plugin.SendClipboardConnect(device, h.content, h.updated); err != nil {
+			log.Println("Cannot send clipboard:", err)
+		}
+	}
+}
+
+func (h *Clipboard) DeviceDisconnected(device *network.Device) {
+	h.Lock()
+	defer h.Unlock()
+	h.devices.DeviceDisconnected(device)
+}
+
+func (h *Clipboard) listen() {
+	h.watch(h.changed)
+
+	for event := range h.plugin.Incoming {
+		h.Lock()
+		apply := h.enabled && h.handle(event)
+		h.Unlock()
+
+		// The lock must not be held while calling into the UI
+		if apply {
+			h.clipboard(event.Content)
+		}
+	}
+}
+
+// handle records the content received from a device, and returns true if it
+// should be applied to the desktop clipboard.
+func (h *Clipboard) handle(event *plugins.ClipboardEvent) bool {
+	if !h.settings.Device(event.Device.Id).SyncClipboard {
+		return false
+	}
+	if event.Content == "" || event.Content == h.content {
+		return false
+	}
+
+	if event.Connect {
+		// The content may have been copied on the device long ago, only
+		// apply it if it's more recent than the desktop's
+		if event.Timestamp <= 0 {
+			return false
+		}
+		updated := time.Unix(0, event.Timestamp*int64(time.Millisecond))
+		if !updated.After(h.updated) {
+			return false
+		}
+	}
+
+	log.Println("Clipboard:", event.Device.Name)
+
+	h.content = event.Content
+	h.updated = time.Now()
+	return true
+}
+
+// changed is called when the content of the desktop clipboard changes.
+func (h *Clipboard) changed(text string) {
+	h.Lock()
+	defer h.Unlock()
+
+	if text == "" || text == h.content {
+		return
+	}
+	h.content = text
+	h.updated = time.Now()
+
+	if !h.enabled {
+		return
+	}
+
+	for _, device := range h.devices {
+		if !h.settings.Device(device.Id).SyncClipboard {
+			continue
+		}
+
+		if err := h.plugin.SendClipboard(device, text); err != nil {
+			log.Println("Cannot send clipboard:", err)
+		}
+	}
+}
+
+func NewClipboard(p *plugins.Clipboard, settings *utils.Settings, clipboard ClipboardFunc, watch WatchClipboardFunc) *Clipboard {
+	return &Clipboard{
+		plugin:    p,
+		settings:  settings,
+		clipboard: clipboard,
+		watch:     watch,
+		devices:   devices{},
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"github.com/emersion/gnomeconnect/plugins"
+	"github.com/emersion/gnomeconnect/utils"
+	"github.com/emersion/go-kdeconnect/network"
+	"testing"
+	"time"
+)
+
+func clipboardEvent(device *network.Device, content string, connect bool, timestamp time.Time) *plugins.ClipboardEvent {
+	event := &plugins.ClipboardEvent{
+		Event:         plugins.Event{Device: device},
+		ClipboardBody: plugins.ClipboardBody{Content: content},
+		Connect:       connect,
+	}
+	if !timestamp.IsZero() {
+		event.Timestamp = timestamp.UnixNano() / int64(time.Millisecond)
+	}
+	return event
+}
+
+func newTestClipboard(device *network.Device) *Clipboard {
+	settings := &utils.Settings{Devices: map[string]*utils.DeviceSettings{}}
+	settings.SetDevice(device.Id, utils.DeviceSettings{SyncClipboard: true})
+
+	watch := func(changed func(text string)) {}
+	return NewClipboard(plugins.NewClipboard(), settings, func(text string) {}, watch)
+}
+
+func TestClipboard(t *testing.T) {
+	device := newTestDevice("a")
+	h := newTestClipboard(device)
+
+	if !h.handle(clipboardEvent(device, "Hello", false, time.Time{})) {
+		t.Fatal("Expected the content to be applied")
+	}
+	if h.handle(clipboardEvent(device, "Hello", false, time.Time{})) {
+		t.Fatal("Expected the same content not to be applied twice")
+	}
+
+	// Devices without clipboard synchronization are ignored
+	if h.handle(clipboardEvent(newTestDevice("b"), "Other", false, time.Time{})) {
+		t.Fatal("Expected the content of other devices to be ignored")
+	}
+}
+
+func TestClipboard_connect(t *testing.T) {
+	device := newTestDevice("a")
+	h := newTestClipboard(device)
+
+	h.changed("Desktop")
+
+	// Copied on the device before the desktop content
+	old := time.Now().Add(-time.Hour)
+	if h.handle(clipboardEvent(device, "Old", true, old)) {
+		t.Fatal("Expected older content sent on connect to be ignored")
+	}
+
+	// Without timestamp, the age of the content is unknown
+	if h.handle(clipboardEvent(device, "Unknown", true, time.Time{})) {
+		t.Fatal("Expected content sent on connect without timestamp to be ignored")
+	}
+
+	recent := time.Now().Add(time.Second)
+	if !h.handle(clipboardEvent(device, "Recent", true, recent)) {
+		t.Fatal("Expected more recent content sent on connect to be applied")
+	}
+	if h.content != "Recent" {
+		t.Fatal("Expected the content to be updated, got", h.content)
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"github.com/emersion/gnomeconnect/plugins"
+	"github.com/emersion/gnomeconnect/utils"
+	"github.com/esiqveland/notify"
+	"github.com/godbus/dbus"
+	"log"
+	"time"
+)
+
+// FindMyPhoneSound is the sound played when a device asks the desktop to ring.
+const FindMyPhoneSound = "/usr/share/sounds/freedesktop/stereo/phone-incoming-call.oga"
+
+// The desktop stops ringing after this delay.
+const findMyPhoneTimeout = time.Minute
+
+// An AudioPlayer plays a sound in a loop until it is stopped.
+type AudioPlayer interface {
+	Play() error
+	Stop() error
+}
+
+// FindMyPhone makes the desktop ring when a device asks for it.
+type FindMyPhone struct {
+	base
+	plugin   *plugins.FindMyPhone
+	notifier Notifier
+	player   AudioPlayer
+	// Starts the timeout, time.AfterFunc outside of tests
+	afterFunc func(d time.Duration, f func()) *time.Timer
+
+	ringing      bool
+	notification int
+	timer        *time.Timer
+}
+
+func (h *FindMyPhone) Name() string {
+	return "findmyphone"
+}
+
+func (h *FindMyPhone) Start() {
+	h.start(h.listen)
+}
+
+func (h *FindMyPhone) Stop() {
+	h.stop(h.stopRinging)
+}
+
+func (h *FindMyPhone) listen() {
+	for event := range h.plugin.Incoming {
+		h.Lock()
+		if h.enabled {
+			h.handle(event)
+		}
+		h.Unlock()
+	}
+}
+
+func (h *FindMyPhone) handle(event *plugins.FindMyPhoneEvent) {
+	log.Println("Find my phone:", event.Device.Name)
+
+	if !h.ringing {
+		if err := h.player.Play(); err != nil {
+			log.Println("Cannot play sound:", err)
+		}
+
+		n := NewNotification()
+		n.AppIcon = utils.GetDeviceIcon(event.Device)
+		n.Summary = event.Device.Name + " is looking for this computer"
+		n.Hints["urgency"] = dbus.MakeVariant(byte(2))
+		n.Hints["resident"] = dbus.MakeVariant(true)
+		n.Actions = []string{"default", "Found it", "found", "Found it"}
+		id, err := h.notifier.Send(n, h)
+		if err != nil {
+			log.Println("Cannot show notification:", err)
+		}
+
+		h.ringing = true
+		h.notification = id
+	}
+
+	// Requests received while ringing restart the timeout
+	if h.timer != nil {
+		h.timer.Stop()
+	}
+	var timer *time.Timer
+	timer = h.afterFunc(findMyPhoneTimeout, func() {
+		h.Lock()
+		defer h.Unlock()
+
+		if h.timer == timer {
+			h.stopRinging()
+		}
+	})
+	h.timer = timer
+}
+
+// stopRinging stops the sound and closes the notification. It must be called
+// with the handler's lock held.
+func (h *FindMyPhone) stopRinging() {
+	if !h.ringing {
+		return
+	}
+	h.ringing = false
+
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+
+	if err := h.player.Stop(); err != nil {
+		log.Println("Cannot stop sound:", err)
+	}
+
+	if h.notification != 0 {
+		h.notifier.Close(h.notification)
+		h.notification = 0
+	}
+}
+
+func (h *FindMyPhone) ActionInvoked(signal *notify.ActionInvokedSignal) {
+	h.Lock()
+	defer h.Unlock()
+
+	if int(signal.Id) == h.notification {
+		h.stopRinging()
+	}
+}
+
+func (h *FindMyPhone) NotificationClosed(signal *notify.NotificationClosedSignal) {
+	h.Lock()
+	defer h.Unlock()
+
+	if int(signal.Id) == h.notification {
+		h.stopRinging()
+	}
+}
+
+func NewFindMyPhone(p *plugins.FindMyPhone, notifier Notifier, player AudioPlayer) *FindMyPhone {
+	return &FindMyPhone{
+		plugin:   p,
+		notifier: notifier,
+		player:   player,
+
+		afterFunc: time.AfterFunc,
+	}
+}
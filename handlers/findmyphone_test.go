@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"github.com/emersion/gnomeconnect/plugins"
+	"github.com/emersion/go-kdeconnect/network"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePlayer is an AudioPlayer counting how many times it was started and
+// stopped.
+type fakePlayer struct {
+	locker  sync.Mutex
+	playing bool
+	played  int
+	stopped int
+}
+
+func (p *fakePlayer) Play() error {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.playing = true
+	p.played++
+	return nil
+}
+
+func (p *fakePlayer) Stop() error {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.playing = false
+	p.stopped++
+	return nil
+}
+
+func (p *fakePlayer) isPlaying() bool {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	return p.playing
+}
+
+func (p *fakePlayer) counts() (played, stopped int) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	return p.played, p.stopped
+}
+
+// fakeTimers records the timers started by a handler, they are fired
+// manually.
+type fakeTimers struct {
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	d     time.Duration
+	f     func()
+	timer *time.Timer
+}
+
+func (ft *fakeTimers) afterFunc(d time.Duration, f func()) *time.Timer {
+	// The real timer never fires during tests, it's only used to know
+	// whether it has been stopped
+	timer := time.NewTimer(time.Hour)
+	ft.timers = append(ft.timers, &fakeTimer{d: d, f: f, timer: timer})
+	return timer
+}
+
+func (ft *fakeTimers) last() *fakeTimer {
+	return ft.timers[len(ft.timers)-1]
+}
+
+func newTestFindMyPhone() (*FindMyPhone, *fakeNotifier, *fakePlayer, *fakeTimers) {
+	notifier := newFakeNotifier()
+	player := &fakePlayer{}
+	timers := &fakeTimers{}
+	h := NewFindMyPhone(plugins.NewFindMyPhone(), notifier, player)
+	h.afterFunc = timers.afterFunc
+	return h, notifier, player, timers
+}
+
+// ring handles a request like listen does, with the handler's lock held.
+func ring(h *FindMyPhone, device *network.Device) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.handle(&plugins.FindMyPhoneEvent{Event: plugins.Event{Device: device}})
+}
+
+func notificationId(h *FindMyPhone) int {
+	h.Lock()
+	defer h.Unlock()
+
+	return h.notification
+}
+
+func TestFindMyPhone(t *testing.T) {
+	h, notifier, player, _ := newTestFindMyPhone()
+	device := newTestDevice("a")
+
+	ring(h, device)
+	if played, _ := player.counts(); played != 1 {
+		t.Fatal("Expected the sound to be played once, got", played)
+	}
+	if notifier.count() != 1 {
+		t.Fatal("Expected a notification, got", notifier.count())
+	}
+
+	// Repeated requests don't start the sound again
+	ring(h, device)
+	if played, _ := player.counts(); played != 1 {
+		t.Fatal("Expected the sound to be played once, got", played)
+	}
+	if notifier.sent != 1 {
+		t.Fatal("Expected a single notification, got", notifier.sent)
+	}
+
+	notifier.invoke(notificationId(h), "found")
+	if player.isPlaying() {
+		t.Fatal("Expected the sound to be stopped")
+	}
+	if notifier.count() != 0 {
+		t.Fatal("Expected the notification to be closed")
+	}
+
+	// Once stopped, a new request rings again
+	ring(h, device)
+	if played, _ := player.counts(); played != 2 {
+		t.Fatal("Expected the sound to be played again, got", played)
+	}
+	h.Stop()
+	if player.isPlaying() {
+		t.Fatal("Expected the sound to be stopped with the handler")
+	}
+}
+
+func TestFindMyPhone_closed(t *testing.T) {
+	h, notifier, player, _ := newTestFindMyPhone()
+
+	ring(h, newTestDevice("a"))
+	notifier.dismiss(notificationId(h))
+	if player.isPlaying() {
+		t.Fatal("Expected the sound to be stopped when the notification is closed")
+	}
+	if _, stopped := player.counts(); stopped != 1 {
+		t.Fatal("Expected the sound to be stopped once, got", stopped)
+	}
+}
+
+func TestFindMyPhone_timeout(t *testing.T) {
+	h, notifier, player, timers := newTestFindMyPhone()
+	device := newTestDevice("a")
+
+	ring(h, device)
+	if len(timers.timers) != 1 || timers.last().d != findMyPhoneTimeout {
+		t.Fatal("Expected the timeout to be started")
+	}
+	first := timers.last()
+
+	// The second request restarts the timeout
+	ring(h, device)
+	if len(timers.timers) != 2 {
+		t.Fatal("Expected the timeout to be restarted, got timers:", len(timers.timers))
+	}
+	if first.timer.Stop() {
+		t.Fatal("Expected the first timeout to be stopped")
+	}
+
+	// The first timeout may have fired while being stopped
+	first.f()
+	if !player.isPlaying() {
+		t.Fatal("Expected the sound to keep playing after an outdated timeout")
+	}
+
+	timers.last().f()
+	if player.isPlaying() {
+		t.Fatal("Expected the sound to be stopped after the timeout")
+	}
+	if played, stopped := player.counts(); played != 1 || stopped != 1 {
+		t.Fatal("Expected the sound to be played and stopped once, got", played, stopped)
+	}
+	if notifier.count() != 0 {
+		t.Fatal("Expected the notification to be closed after the timeout")
+	}
+}
@@ -0,0 +1,156 @@
+// Package handlers contains the desktop side of KDE Connect plugins: each
+// handler consumes the events of one plugin and reacts to them.
+package handlers
+
+import (
+	"errors"
+	"github.com/emersion/go-kdeconnect/network"
+	"sync"
+)
+
+// A Handler reacts to the events emitted by a KDE Connect plugin.
+type Handler interface {
+	// Name identifies the handler, e.g. "battery".
+	Name() string
+	// Start enables the handler. It must not block.
+	Start()
+	// Stop disables the handler and releases its resources, e.g. closes its
+	// notifications. Events received while the handler is stopped are dropped.
+	Stop()
+	Enabled() bool
+}
+
+// A DeviceObserver is notified when paired devices become reachable or
+// unreachable. Handlers can implement it to send packages on their own.
+type DeviceObserver interface {
+	DeviceConnected(device *network.Device)
+	DeviceDisconnected(device *network.Device)
+}
+
+// devices keeps track of connected paired devices. Its methods must be called
+// with the handler's lock held.
+type devices map[string]*network.Device
+
+func (d devices) DeviceConnected(device *network.Device) {
+	d[device.Id] = device
+}
+
+func (d devices) DeviceDisconnected(device *network.Device) {
+	delete(d, device.Id)
+}
+
+// base implements the lifecycle shared by all handlers. Its mutex must be held
+// while handling an event or accessing the handler's state.
+type base struct {
+	sync.Mutex
+	once    sync.Once
+	enabled bool
+}
+
+func (b *base) Enabled() bool {
+	b.Lock()
+	defer b.Unlock()
+	return b.enabled
+}
+
+// start enables the handler. listen is started the first time the handler is
+// enabled and must keep draining plugin events for the lifetime of the
+// process, otherwise the plugin would block.
+func (b *base) start(listen func()) {
+	b.Lock()
+	b.enabled = true
+	b.Unlock()
+
+	b.once.Do(func() {
+		go listen()
+	})
+}
+
+// stop disables the handler and calls cleanup, if any, with the lock held.
+func (b *base) stop(cleanup func()) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.enabled = false
+	if cleanup != nil {
+		cleanup()
+	}
+}
+
+var ErrNoSuchHandler = errors.New("No such handler")
+
+// A Registry holds all handlers.
+type Registry struct {
+	handlers []Handler
+}
+
+func (r *Registry) Register(h Handler) {
+	r.handlers = append(r.handlers, h)
+}
+
+func (r *Registry) Get(name string) Handler {
+	for _, h := range r.handlers {
+		if h.Name() == name {
+			return h
+		}
+	}
+	return nil
+}
+
+func (r *Registry) Enable(name string) error {
+	h := r.Get(name)
+	if h == nil {
+		return ErrNoSuchHandler
+	}
+
+	h.Start()
+	return nil
+}
+
+func (r *Registry) Disable(name string) error {
+	h := r.Get(name)
+	if h == nil {
+		return ErrNoSuchHandler
+	}
+
+	h.Stop()
+	return nil
+}
+
+// DeviceConnected notifies handlers implementing DeviceObserver that a paired
+// device is reachable.
+func (r *Registry) DeviceConnected(device *network.Device) {
+	for _, h := range r.handlers {
+		if o, ok := h.(DeviceObserver); ok {
+			o.DeviceConnected(device)
+		}
+	}
+}
+
+// DeviceDisconnected notifies handlers implementing DeviceObserver that a
+// device is no longer reachable or has been unpaired.
+func (r *Registry) DeviceDisconnected(device *network.Device) {
+	for _, h := range r.handlers {
+		if o, ok := h.(DeviceObserver); ok {
+			o.DeviceDisconnected(device)
+		}
+	}
+}
+
+// Start starts all registered handlers.
+func (r *Registry) Start() {
+	for _, h := range r.handlers {
+		h.Start()
+	}
+}
+
+// Stop stops all registered handlers.
+func (r *Registry) Stop() {
+	for _, h := range r.handlers {
+		h.Stop()
+	}
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"github.com/emersion/go-kdeconnect/network"
+	"github.com/esiqveland/notify"
+	"sync"
+	"testing"
+)
+
+// fakeNotifier is a Notifier keeping notifications in memory.
+type fakeNotifier struct {
+	locker    sync.Mutex
+	lastId    int
+	open      map[int]notify.Notification
+	listeners map[int]NotificationListener
+	sent      int
+	closed    int
+}
+
+func newFakeNotifier() *fakeNotifier {
+	return &fakeNotifier{
+		open:      map[int]notify.Notification{},
+		listeners: map[int]NotificationListener{},
+	}
+}
+
+func (n *fakeNotifier) Send(notification notify.Notification, l NotificationListener) (int, error) {
+	n.locker.Lock()
+	defer n.locker.Unlock()
+
+	id := int(notification.ReplacesID)
+	if id == 0 {
+		n.lastId++
+		id = n.lastId
+	}
+
+	n.open[id] = notification
+	if l != nil {
+		n.listeners[id] = l
+	} else {
+		delete(n.listeners, id)
+	}
+	n.sent++
+	return id, nil
+}
+
+func (n *fakeNotifier) Close(id int) error {
+	n.locker.Lock()
+	defer n.locker.Unlock()
+
+	if _, ok := n.open[id]; ok {
+		delete(n.open, id)
+		n.closed++
+	}
+	return nil
+}
+
+// get returns an open notification.
+func (n *fakeNotifier) get(id int) (notify.Notification, bool) {
+	n.locker.Lock()
+	defer n.locker.Unlock()
+
+	notification, ok := n.open[id]
+	return notification, ok
+}
+
+// count returns the number of open notifications.
+func (n *fakeNotifier) count() int {
+	n.locker.Lock()
+	defer n.locker.Unlock()
+
+	return len(n.open)
+}
+
+// invoke simulates the user clicking on a notification action.
+func (n *fakeNotifier) invoke(id int, action string) {
+	n.locker.Lock()
+	l := n.listeners[id]
+	n.locker.Unlock()
+
+	if l != nil {
+		l.ActionInvoked(&notify.ActionInvokedSignal{Id: uint32(id), ActionKey: action})
+	}
+}
+
+// dismiss simulates the user closing a notification.
+func (n *fakeNotifier) dismiss(id int) {
+	n.locker.Lock()
+	l := n.listeners[id]
+	delete(n.open, id)
+	n.locker.Unlock()
+
+	if l != nil {
+		l.NotificationClosed(&notify.NotificationClosedSignal{Id: uint32(id), Reason: notify.ReasonDismissedByUser})
+	}
+}
+
+func newTestDevice(id string) *network.Device {
+	return &network.Device{
+		Id:     id,
+		Name:   "Device " + id,
+		Type:   "phone",
+		Paired: true,
+	}
+}
+
+type testHandler struct {
+	base
+	name string
+}
+
+func (h *testHandler) Name() string {
+	return h.name
+}
+
+func (h *testHandler) Start() {
+	h.start(func() {})
+}
+
+func (h *testHandler) Stop() {
+	h.stop(nil)
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	h := &testHandler{name: "test"}
+	r.Register(h)
+
+	if r.Get("test") != h {
+		t.Fatal("Expected to get the registered handler")
+	}
+	if r.Get("missing") != nil {
+		t.Fatal("Expected no handler for an unknown name")
+	}
+
+	r.Start()
+	if !h.Enabled() {
+		t.Fatal("Expected handler to be enabled after Start")
+	}
+
+	if err := r.Disable("test"); err != nil {
+		t.Fatal("Expected no error when disabling handler, got", err)
+	}
+	if h.Enabled() {
+		t.Fatal("Expected handler to be disabled")
+	}
+
+	if err := r.Enable("missing"); err != ErrNoSuchHandler {
+		t.Fatal("Expected ErrNoSuchHandler, got", err)
+	}
+}
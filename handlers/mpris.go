@@ -0,0 +1,523 @@
+package handlers
+
+import (
+	"github.com/emersion/gnomeconnect/plugins"
+	"github.com/emersion/go-kdeconnect/network"
+	"github.com/emersion/go-mpris"
+	"github.com/godbus/dbus"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Changes of a player are merged during this delay before being pushed to
+// devices, players often emit bursts of PropertiesChanged signals.
+const mprisDebounce = 200 * time.Millisecond
+
+const (
+	mprisPrefix          = "org.mpris.MediaPlayer2."
+	mprisPath            = "/org/mpris/MediaPlayer2"
+	mprisPlayerInterface = "org.mpris.MediaPlayer2.Player"
+	mprisNoTrack         = "/org/mpris/MediaPlayer2/TrackList/NoTrack"
+)
+
+type Mpris struct {
+	base
+	plugin *plugins.Mpris
+	conn   *dbus.Conn
+
+	devices devices
+	// Maps unique bus names to player names
+	owners map[string]string
+	// Players with pending changes or a known state, by name
+	players map[string]*mprisPlayer
+}
+
+// mprisPlayer keeps the state of a player last pushed to devices, and its
+// changes not pushed yet.
+type mprisPlayer struct {
+	// nil if unknown, all properties are queried on next push
+	state   *plugins.MprisBody
+	changed map[string]dbus.Variant
+	timer   *time.Timer
+}
+
+func (h *Mpris) Name() string {
+	return "mpris"
+}
+
+func (h *Mpris) Start() {
+	h.start(h.listen)
+}
+
+func (h *Mpris) Stop() {
+	h.stop(func() {
+		for _, p := range h.players {
+			if p.timer != nil {
+				p.timer.Stop()
+			}
+		}
+		h.players = map[string]*mprisPlayer{}
+	})
+}
+
+func (h *Mpris) DeviceConnected(device *network.Device) {
+	h.Lock()
+	defer h.Unlock()
+	h.devices.DeviceConnected(device)
+}
+
+func (h *Mpris) DeviceDisconnected(device *network.Device) {
+	h.Lock()
+	defer h.Unlock()
+	h.devices.DeviceDisconnected(device)
+}
+
+func (h *Mpris) listen() {
+	go h.watch()
+
+	// Requests are handled without the lock held: they call the bus, and
+	// watch must be able to take the lock to drain signals meanwhile
+	for event := range h.plugin.Incoming {
+		if h.Enabled() {
+			h.handle(event)
+		}
+	}
+}
+
+func (h *Mpris) getProperty(player, name string) dbus.Variant {
+	v, err := h.conn.Object(player, mprisPath).GetProperty(mprisPlayerInterface + "." + name)
+	if err != nil {
+		return dbus.Variant{}
+	}
+	return v
+}
+
+func (h *Mpris) getMetadata(player string) *mprisMetadata {
+	m, _ := h.getProperty(player, "Metadata").Value().(map[string]dbus.Variant)
+	return decodeMprisMetadata(m)
+}
+
+// getPosition returns the position of a player, in microseconds.
+func (h *Mpris) getPosition(player string) int64 {
+	pos, _ := toInt64(h.getProperty(player, "Position").Value())
+	return pos
+}
+
+func (h *Mpris) setProperty(player, name string, value interface{}) error {
+	obj := h.conn.Object(player, mprisPath)
+	call := obj.Call("org.freedesktop.DBus.Properties.Set", 0, mprisPlayerInterface, name, dbus.MakeVariant(value))
+	return call.Err
+}
+
+func (h *Mpris) seek(player string, offset int64) error {
+	obj := h.conn.Object(player, mprisPath)
+	return obj.Call(mprisPlayerInterface+".Seek", 0, offset).Err
+}
+
+// setPosition sets the position of the current track, in microseconds.
+func (h *Mpris) setPosition(player string, position int64) error {
+	trackId := h.getMetadata(player).TrackId
+	if trackId == "" || !trackId.IsValid() || trackId == mprisNoTrack {
+		// SetPosition needs the track ID, seek relatively instead
+		return h.seek(player, position-h.getPosition(player))
+	}
+
+	obj := h.conn.Object(player, mprisPath)
+	return obj.Call(mprisPlayerInterface+".SetPosition", 0, trackId, position).Err
+}
+
+// sendAlbumArt sends a local album art to a device. Only the art of the
+// player's current track can be requested, devices must not be able to read
+// arbitrary files.
+func (h *Mpris) sendAlbumArt(event *plugins.MprisEvent) {
+	state := h.nowPlaying(event.Player)
+	if event.AlbumArtUrl != state.AlbumArtUrl {
+		log.Println("Warning: ignoring request for album art not matching the current track", event.AlbumArtUrl)
+		return
+	}
+
+	u, err := url.Parse(event.AlbumArtUrl)
+	if err != nil || u.Scheme != "file" {
+		log.Println("Cannot send album art: unsupported URL", event.AlbumArtUrl)
+		return
+	}
+
+	f, err := os.Open(u.Path)
+	if err != nil {
+		log.Println("Cannot open album art:", err)
+		return
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		log.Println("Cannot open album art:", err)
+		return
+	}
+
+	err = h.plugin.SendAlbumArt(event.Device, state, f, info.Size())
+	if err != nil {
+		log.Println("Cannot send album art:", err)
+	}
+}
+
+// getAll returns all properties of a player.
+func (h *Mpris) getAll(player string) map[string]dbus.Variant {
+	var props map[string]dbus.Variant
+	obj := h.conn.Object(player, mprisPath)
+	err := obj.Call("org.freedesktop.DBus.Properties.GetAll", 0, mprisPlayerInterface).Store(&props)
+	if err != nil {
+		log.Println("Cannot get MPRIS player properties:", err)
+	}
+	return props
+}
+
+// updateMprisBody updates the state of a player with changed properties.
+func updateMprisBody(body *plugins.MprisBody, props map[string]dbus.Variant) {
+	for name, v := range props {
+		value := v.Value()
+
+		switch name {
+		case "Metadata":
+			m, _ := value.(map[string]dbus.Variant)
+			metadata := decodeMprisMetadata(m)
+
+			artist := strings.Join(metadata.Artist, ", ")
+			body.NowPlaying = metadata.Title
+			if artist != "" {
+				body.NowPlaying = artist + " - " + metadata.Title
+			}
+			body.Title = metadata.Title
+			body.Artist = artist
+			body.Album = metadata.Album
+			body.AlbumArtUrl = metadata.ArtUrl
+			body.Length = metadata.Length / 1000
+		case "PlaybackStatus":
+			body.IsPlaying = toString(value) == "Playing"
+		case "Position":
+			pos, _ := toInt64(value)
+			body.Pos = pos / 1000
+		case "Volume":
+			vol, _ := toFloat64(value)
+			body.Volume = int(vol * 100)
+		case "Shuffle":
+			body.Shuffle = toBool(value)
+		case "LoopStatus":
+			body.LoopStatus = toString(value)
+		case "CanPause":
+			body.CanPause = toBool(value)
+		case "CanPlay":
+			body.CanPlay = toBool(value)
+		case "CanGoNext":
+			body.CanGoNext = toBool(value)
+		case "CanGoPrevious":
+			body.CanGoPrevious = toBool(value)
+		case "CanSeek":
+			body.CanSeek = toBool(value)
+		}
+	}
+}
+
+// nowPlaying describes the current state of a player.
+func (h *Mpris) nowPlaying(name string) *plugins.MprisBody {
+	body := &plugins.MprisBody{Player: name}
+	updateMprisBody(body, h.getAll(name))
+	return body
+}
+
+func (h *Mpris) handle(event *plugins.MprisEvent) {
+	log.Println("Mpris:", event.Device.Name, event.MprisRequestBody)
+
+	if event.RequestPlayerList {
+		names, err := mpris.List(h.conn)
+		if err != nil {
+			log.Println("Warning: cannot list available MPRIS players", err)
+			return
+		}
+
+		h.plugin.SendPlayerList(event.Device, names)
+	}
+
+	if event.Player == "" {
+		return
+	}
+
+	player := mpris.New(h.conn, event.Player)
+
+	event.RequestNowPlaying = true
+	switch event.Action {
+	case "Next":
+		player.Next()
+	case "Previous":
+		player.Previous()
+	case "Pause":
+		player.Pause()
+	case "PlayPause":
+		player.PlayPause()
+	case "Stop":
+		player.Stop()
+	case "Play":
+		player.Play()
+	default:
+		event.RequestNowPlaying = false
+	}
+
+	if event.SetShuffle != nil {
+		if err := h.setProperty(event.Player, "Shuffle", *event.SetShuffle); err != nil {
+			log.Println("Cannot set shuffle:", err)
+		}
+		event.RequestNowPlaying = true
+	}
+
+	if event.SetLoopStatus != "" {
+		if err := h.setProperty(event.Player, "LoopStatus", event.SetLoopStatus); err != nil {
+			log.Println("Cannot set loop status:", err)
+		}
+		event.RequestNowPlaying = true
+	}
+
+	if event.Seek != 0 {
+		if err := h.seek(event.Player, event.Seek); err != nil {
+			log.Println("Cannot seek:", err)
+		}
+		event.RequestNowPlaying = true
+	}
+
+	if event.SetPosition != nil {
+		err := h.setPosition(event.Player, *event.SetPosition*1000)
+		if err != nil {
+			log.Println("Cannot set position:", err)
+		}
+		event.RequestNowPlaying = true
+	}
+
+	if event.SetVolume != nil {
+		player.SetVolume(float64(*event.SetVolume) / 100)
+		event.RequestVolume = true
+	}
+
+	if event.AlbumArtUrl != "" {
+		h.sendAlbumArt(event)
+	}
+
+	// Devices replace their state with the values they receive, always send
+	// the whole state, even if only the volume was requested
+	if event.RequestNowPlaying || event.RequestVolume {
+		h.plugin.SendPlayer(event.Device, h.nowPlaying(event.Player))
+	}
+}
+
+// listOwners returns the names of all players, and a map of their unique
+// names to their names.
+func (h *Mpris) listOwners() ([]string, map[string]string, error) {
+	names, err := mpris.List(h.conn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	owners := map[string]string{}
+	for _, name := range names {
+		var owner string
+		err := h.conn.BusObject().Call("org.freedesktop.DBus.GetNameOwner", 0, name).Store(&owner)
+		if err != nil {
+			continue
+		}
+		owners[owner] = name
+	}
+
+	return names, owners, nil
+}
+
+// refreshPlayers updates the owners of players, and sends the list of players
+// to all devices. The bus is queried without the handler's lock held.
+func (h *Mpris) refreshPlayers() {
+	names, owners, err := h.listOwners()
+	if err != nil {
+		log.Println("Warning: cannot list available MPRIS players", err)
+		return
+	}
+
+	h.Lock()
+	h.owners = owners
+	players := map[string]*mprisPlayer{}
+	for _, name := range names {
+		if p, ok := h.players[name]; ok {
+			players[name] = p
+		}
+	}
+	h.players = players
+
+	enabled := h.enabled
+	devices := make([]*network.Device, 0, len(h.devices))
+	for _, device := range h.devices {
+		devices = append(devices, device)
+	}
+	h.Unlock()
+
+	if !enabled {
+		return
+	}
+
+	for _, device := range devices {
+		if err := h.plugin.SendPlayerList(device, names); err != nil {
+			log.Println("Cannot send MPRIS player list:", err)
+		}
+	}
+}
+
+// watchOwners refreshes players each time a value is received on changed.
+func (h *Mpris) watchOwners(changed <-chan struct{}) {
+	for range changed {
+		h.refreshPlayers()
+	}
+}
+
+// playerChanged records changed properties of a player, they are pushed to
+// devices after a short delay. It must be called with the handler's lock held.
+func (h *Mpris) playerChanged(name string, changed map[string]dbus.Variant, invalidated []string) {
+	p, ok := h.players[name]
+	if !ok {
+		p = &mprisPlayer{}
+		h.players[name] = p
+	}
+
+	if p.changed == nil {
+		p.changed = map[string]dbus.Variant{}
+	}
+	for k, v := range changed {
+		p.changed[k] = v
+	}
+	if len(invalidated) > 0 {
+		p.state = nil
+	}
+
+	if p.timer == nil {
+		p.timer = time.AfterFunc(mprisDebounce, func() {
+			h.pushPlayer(name)
+		})
+	}
+}
+
+// pushPlayer sends the state of a player to all devices. Players are queried
+// without the handler's lock held.
+func (h *Mpris) pushPlayer(name string) {
+	h.Lock()
+	p, ok := h.players[name]
+	if !ok {
+		h.Unlock()
+		return
+	}
+	p.timer = nil
+
+	if !h.enabled || len(h.devices) == 0 {
+		// Changes are lost, the state will be queried on next push
+		p.state = nil
+		p.changed = nil
+		h.Unlock()
+		return
+	}
+
+	var state *plugins.MprisBody
+	if p.state != nil {
+		last := *p.state
+		state = &last
+	}
+	changed := p.changed
+	p.changed = nil
+
+	devices := make([]*network.Device, 0, len(h.devices))
+	for _, device := range h.devices {
+		devices = append(devices, device)
+	}
+	h.Unlock()
+
+	if state != nil {
+		updateMprisBody(state, changed)
+		// The position isn't included in PropertiesChanged signals
+		state.Pos = h.getPosition(name) / 1000
+	} else {
+		state = h.nowPlaying(name)
+	}
+
+	h.Lock()
+	if h.players[name] == p {
+		pushed := *state
+		p.state = &pushed
+	}
+	h.Unlock()
+
+	for _, device := range devices {
+		if err := h.plugin.SendPlayer(device, state); err != nil {
+			log.Println("Cannot send MPRIS player state:", err)
+		}
+	}
+}
+
+// watch listens for players changes on the session bus, and pushes them to
+// devices.
+func (h *Mpris) watch() {
+	rules := []string{
+		"type='signal',interface='org.freedesktop.DBus.Properties',member='PropertiesChanged',path='" + mprisPath + "'",
+		"type='signal',interface='org.freedesktop.DBus',member='NameOwnerChanged',arg0namespace='org.mpris.MediaPlayer2'",
+	}
+	for _, rule := range rules {
+		call := h.conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, rule)
+		if call.Err != nil {
+			log.Println("Cannot watch MPRIS players:", call.Err)
+			return
+		}
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	h.conn.Signal(signals)
+
+	// The signal channel receives all signals of the session bus, it must
+	// not be blocked by calls to the bus
+	ownersChanged := make(chan struct{}, 1)
+	ownersChanged <- struct{}{}
+	go h.watchOwners(ownersChanged)
+
+	for signal := range signals {
+		if len(signal.Body) == 0 {
+			continue
+		}
+
+		h.Lock()
+		if !h.enabled {
+			h.Unlock()
+			continue
+		}
+
+		switch signal.Name {
+		case "org.freedesktop.DBus.NameOwnerChanged":
+			if name, ok := signal.Body[0].(string); ok && strings.HasPrefix(name, mprisPrefix) {
+				select {
+				case ownersChanged <- struct{}{}:
+				default:
+					// A refresh is already pending
+				}
+			}
+		case "org.freedesktop.DBus.Properties.PropertiesChanged":
+			iface, _ := signal.Body[0].(string)
+			if name, ok := h.owners[signal.Sender]; ok && iface == mprisPlayerInterface && len(signal.Body) >= 3 {
+				changed, _ := signal.Body[1].(map[string]dbus.Variant)
+				invalidated, _ := signal.Body[2].([]string)
+				h.playerChanged(name, changed, invalidated)
+			}
+		}
+		h.Unlock()
+	}
+}
+
+func NewMpris(p *plugins.Mpris, conn *dbus.Conn) *Mpris {
+	return &Mpris{
+		plugin:  p,
+		conn:    conn,
+		devices: devices{},
+		owners:  map[string]string{},
+		players: map[string]*mprisPlayer{},
+	}
+}
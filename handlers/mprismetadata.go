@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"github.com/godbus/dbus"
+	"strconv"
+	"strings"
+)
+
+// mprisMetadata contains the fields of MPRIS metadata we use. Players are not
+// consistent about types (e.g. mpris:length can be an int64, a uint64 or an
+// int32 and browsers sometimes send it as a double), and can omit any field,
+// so all of them are decoded leniently.
+type mprisMetadata struct {
+	TrackId dbus.ObjectPath
+	Title   string
+	Artist  []string
+	Album   string
+	ArtUrl  string
+	// In microseconds, zero if unknown
+	Length int64
+}
+
+func decodeMprisMetadata(m map[string]dbus.Variant) *mprisMetadata {
+	md := &mprisMetadata{
+		Title:  toString(variantValue(m, "xesam:title")),
+		Artist: toStrings(variantValue(m, "xesam:artist")),
+		Album:  toString(variantValue(m, "xesam:album")),
+		ArtUrl: toString(variantValue(m, "mpris:artUrl")),
+	}
+
+	md.Length, _ = toInt64(variantValue(m, "mpris:length"))
+
+	switch id := unwrapVariant(variantValue(m, "mpris:trackid")).(type) {
+	case dbus.ObjectPath:
+		md.TrackId = id
+	case string:
+		md.TrackId = dbus.ObjectPath(id)
+	}
+
+	return md
+}
+
+func variantValue(m map[string]dbus.Variant, key string) interface{} {
+	v, ok := m[key]
+	if !ok {
+		return nil
+	}
+	return v.Value()
+}
+
+// unwrapVariant returns the value of v if it's a variant, players sometimes
+// nest them.
+func unwrapVariant(v interface{}) interface{} {
+	for {
+		variant, ok := v.(dbus.Variant)
+		if !ok {
+			return v
+		}
+		v = variant.Value()
+	}
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch v := unwrapVariant(v).(type) {
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case byte:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	case string:
+		i, err := strconv.ParseInt(v, 10, 64)
+		return i, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	if f, ok := unwrapVariant(v).(float64); ok {
+		return f, true
+	}
+
+	i, ok := toInt64(v)
+	return float64(i), ok
+}
+
+func toBool(v interface{}) bool {
+	b, _ := unwrapVariant(v).(bool)
+	return b
+}
+
+func toString(v interface{}) string {
+	switch v := unwrapVariant(v).(type) {
+	case string:
+		return v
+	case dbus.ObjectPath:
+		return string(v)
+	case []string:
+		return strings.Join(v, ", ")
+	default:
+		return ""
+	}
+}
+
+func toStrings(v interface{}) []string {
+	switch v := unwrapVariant(v).(type) {
+	case []string:
+		return v
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	case []interface{}:
+		var l []string
+		for _, item := range v {
+			if s := toString(item); s != "" {
+				l = append(l, s)
+			}
+		}
+		return l
+	default:
+		return nil
+	}
+}
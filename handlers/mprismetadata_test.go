@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"github.com/godbus/dbus"
+	"reflect"
+	"testing"
+)
+
+var mprisMetadataTests = []struct {
+	name     string
+	metadata map[string]dbus.Variant
+	expected *mprisMetadata
+}{
+	{
+		name: "VLC",
+		metadata: map[string]dbus.Variant{
+			"mpris:trackid":        dbus.MakeVariant(dbus.ObjectPath("/org/videolan/vlc/playlist/5")),
+			"xesam:url":            dbus.MakeVariant("file:///home/user/Music/Daft%20Punk/Discovery/01%20One%20More%20Time.flac"),
+			"xesam:title":          dbus.MakeVariant("One More Time"),
+			"xesam:artist":         dbus.MakeVariant([]string{"Daft Punk"}),
+			"xesam:album":          dbus.MakeVariant("Discovery"),
+			"xesam:tracknumber":    dbus.MakeVariant("1"),
+			"vlc:time":             dbus.MakeVariant(uint32(320)),
+			"mpris:length":         dbus.MakeVariant(int64(320357000)),
+			"mpris:artUrl":         dbus.MakeVariant("file:///home/user/.cache/vlc/art/artistalbum/Daft%20Punk/Discovery/art.jpg"),
+			"vlc:length":           dbus.MakeVariant(int64(320357)),
+			"vlc:publisher":        dbus.MakeVariant(int32(2001)),
+			"vlc:encodedby":        dbus.MakeVariant(""),
+			"xesam:contentCreated": dbus.MakeVariant("2001"),
+		},
+		expected: &mprisMetadata{
+			TrackId: "/org/videolan/vlc/playlist/5",
+			Title:   "One More Time",
+			Artist:  []string{"Daft Punk"},
+			Album:   "Discovery",
+			ArtUrl:  "file:///home/user/.cache/vlc/art/artistalbum/Daft%20Punk/Discovery/art.jpg",
+			Length:  320357000,
+		},
+	},
+	{
+		// Spotify sends its track URI as a string, and the length as a uint64
+		name: "Spotify",
+		metadata: map[string]dbus.Variant{
+			"mpris:trackid":     dbus.MakeVariant("spotify:track:0DiWol3AO6WpXZgp0goxAV"),
+			"mpris:length":      dbus.MakeVariant(uint64(320357000)),
+			"mpris:artUrl":      dbus.MakeVariant("https://open.spotify.com/image/ab67616d0000b273b33d46dfa2635a47eebf63b2"),
+			"xesam:album":       dbus.MakeVariant("Discovery"),
+			"xesam:albumArtist": dbus.MakeVariant([]string{"Daft Punk"}),
+			"xesam:artist":      dbus.MakeVariant([]string{"Daft Punk"}),
+			"xesam:autoRating":  dbus.MakeVariant(0.77),
+			"xesam:discNumber":  dbus.MakeVariant(int32(1)),
+			"xesam:title":       dbus.MakeVariant("One More Time"),
+			"xesam:trackNumber": dbus.MakeVariant(int32(1)),
+			"xesam:url":         dbus.MakeVariant("https://open.spotify.com/track/0DiWol3AO6WpXZgp0goxAV"),
+		},
+		expected: &mprisMetadata{
+			TrackId: "spotify:track:0DiWol3AO6WpXZgp0goxAV",
+			Title:   "One More Time",
+			Artist:  []string{"Daft Punk"},
+			Album:   "Discovery",
+			ArtUrl:  "https://open.spotify.com/image/ab67616d0000b273b33d46dfa2635a47eebf63b2",
+			Length:  320357000,
+		},
+	},
+	{
+		// Live streams in Chromium have no length
+		name: "Chromium live stream",
+		metadata: map[string]dbus.Variant{
+			"mpris:trackid": dbus.MakeVariant(dbus.ObjectPath("/org/chromium/MediaPlayer2/TrackList/TrackFd6f1a2e2e0e4a2c")),
+			"xesam:title":   dbus.MakeVariant("lofi hip hop radio - beats to relax/study to"),
+			"xesam:artist":  dbus.MakeVariant([]string{"Lofi Girl"}),
+			"xesam:album":   dbus.MakeVariant(""),
+			"mpris:artUrl":  dbus.MakeVariant("file:///tmp/.org.chromium.Chromium.Yx3kQa"),
+		},
+		expected: &mprisMetadata{
+			TrackId: "/org/chromium/MediaPlayer2/TrackList/TrackFd6f1a2e2e0e4a2c",
+			Title:   "lofi hip hop radio - beats to relax/study to",
+			Artist:  []string{"Lofi Girl"},
+			ArtUrl:  "file:///tmp/.org.chromium.Chromium.Yx3kQa",
+		},
+	},
+	{
+		// A browser player sending the length as a double, and the artist as a
+		// string
+		name: "Firefox",
+		metadata: map[string]dbus.Variant{
+			"mpris:trackid": dbus.MakeVariant(dbus.ObjectPath("/org/mpris/MediaPlayer2/firefox")),
+			"mpris:length":  dbus.MakeVariant(float64(212000000)),
+			"xesam:title":   dbus.MakeVariant("Get Lucky (Official Audio)"),
+			"xesam:artist":  dbus.MakeVariant("Daft Punk"),
+			"xesam:album":   dbus.MakeVariant("Random Access Memories"),
+		},
+		expected: &mprisMetadata{
+			TrackId: "/org/mpris/MediaPlayer2/firefox",
+			Title:   "Get Lucky (Official Audio)",
+			Artist:  []string{"Daft Punk"},
+			Album:   "Random Access Memories",
+			Length:  212000000,
+		},
+	},
+	{
+		// Some players built on older MPRIS libraries send the length as an
+		// int32, in microseconds
+		name: "int32 length",
+		metadata: map[string]dbus.Variant{
+			"mpris:trackid": dbus.MakeVariant(dbus.ObjectPath("/org/mpris/MediaPlayer2/Track/12")),
+			"mpris:length":  dbus.MakeVariant(int32(180000000)),
+			"xesam:title":   dbus.MakeVariant("Short Track"),
+			"xesam:artist":  dbus.MakeVariant([]string{"Artist A", "Artist B"}),
+		},
+		expected: &mprisMetadata{
+			TrackId: "/org/mpris/MediaPlayer2/Track/12",
+			Title:   "Short Track",
+			Artist:  []string{"Artist A", "Artist B"},
+			Length:  180000000,
+		},
+	},
+	{
+		// Values wrapped in several variants, and an artist list of variants
+		name: "nested variants",
+		metadata: map[string]dbus.Variant{
+			"mpris:trackid": dbus.MakeVariant(dbus.MakeVariant(dbus.ObjectPath("/org/mpris/MediaPlayer2/Track/3"))),
+			"mpris:length":  dbus.MakeVariant(dbus.MakeVariant(int64(240000000))),
+			"xesam:title":   dbus.MakeVariant(dbus.MakeVariant("Nested")),
+			"xesam:artist": dbus.MakeVariant([]interface{}{
+				dbus.MakeVariant("Artist A"),
+				dbus.MakeVariant(dbus.MakeVariant("Artist B")),
+			}),
+			"mpris:artUrl": dbus.MakeVariant(dbus.MakeVariant("file:///tmp/cover.png")),
+		},
+		expected: &mprisMetadata{
+			TrackId: "/org/mpris/MediaPlayer2/Track/3",
+			Title:   "Nested",
+			Artist:  []string{"Artist A", "Artist B"},
+			ArtUrl:  "file:///tmp/cover.png",
+			Length:  240000000,
+		},
+	},
+	{
+		name:     "empty",
+		metadata: map[string]dbus.Variant{},
+		expected: &mprisMetadata{},
+	},
+	{
+		name:     "nil",
+		metadata: nil,
+		expected: &mprisMetadata{},
+	},
+}
+
+func TestDecodeMprisMetadata(t *testing.T) {
+	for _, test := range mprisMetadataTests {
+		md := decodeMprisMetadata(test.metadata)
+		if !reflect.DeepEqual(md, test.expected) {
+			t.Errorf("%v: invalid metadata:\n%+v\nexpected:\n%+v", test.name, md, test.expected)
+		}
+	}
+}
+
+func TestToInt64(t *testing.T) {
+	values := []interface{}{
+		int64(42),
+		uint64(42),
+		int32(42),
+		uint32(42),
+		float64(42),
+		"42",
+		dbus.MakeVariant(int64(42)),
+	}
+
+	for _, v := range values {
+		if i, ok := toInt64(v); !ok || i != 42 {
+			t.Errorf("toInt64(%#v) = %v, %v, expected 42", v, i, ok)
+		}
+	}
+
+	if _, ok := toInt64("not a number"); ok {
+		t.Error("Expected toInt64 to fail on an invalid string")
+	}
+	if _, ok := toInt64(nil); ok {
+		t.Error("Expected toInt64 to fail on nil")
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"github.com/emersion/gnomeconnect/plugins"
+	"github.com/emersion/gnomeconnect/utils"
+	"github.com/emersion/go-kdeconnect/network"
+	"github.com/esiqveland/notify"
+	"log"
+	"strings"
+)
+
+// A PromptFunc asks the user for some text, and calls send with it. It must
+// not block, and is called without the handler's lock held.
+type PromptFunc func(title, text string, send func(message string))
+
+// A remoteNotification is a notification received from a device and mirrored
+// on the desktop.
+type remoteNotification struct {
+	device         *network.Device
+	id             string
+	appName        string
+	ticker         string
+	requestReplyId string
+}
+
+// notificationKey returns a key identifying a remote notification. IDs are only
+// unique per device.
+func notificationKey(device *network.Device, id string) string {
+	return device.Id + "/" + id
+}
+
+type Notification struct {
+	base
+	plugin   *plugins.Notification
+	notifier Notifier
+	prompt   PromptFunc
+
+	// Maps remote notification keys to desktop IDs
+	ids           map[string]int
+	notifications map[int]*remoteNotification
+}
+
+func (h *Notification) Name() string {
+	return "notification"
+}
+
+func (h *Notification) Start() {
+	h.start(h.listen)
+}
+
+func (h *Notification) Stop() {
+	h.stop(func() {
+		for id := range h.notifications {
+			h.notifier.Close(id)
+		}
+		h.ids = map[string]int{}
+		h.notifications = map[int]*remoteNotification{}
+	})
+}
+
+func (h *Notification) listen() {
+	for event := range h.plugin.Incoming {
+		h.Lock()
+		if h.enabled {
+			h.handle(event)
+		}
+		h.Unlock()
+	}
+}
+
+func (h *Notification) handle(event *plugins.NotificationEvent) {
+	log.Println("Notification:", event.Device.Name, event.NotificationBody)
+
+	key := notificationKey(event.Device, event.NotificationBody.Id)
+	id, exists := h.ids[key]
+
+	if event.IsCancel {
+		if exists {
+			delete(h.ids, key)
+			delete(h.notifications, id)
+			h.notifier.Close(id)
+		}
+		return
+	}
+
+	n := NewNotification()
+	n.AppIcon = utils.GetDeviceIcon(event.Device)
+	n.Summary = "Notification from " + event.AppName + " on " + event.Device.Name
+	n.Body = event.Ticker
+	if exists {
+		n.ReplacesID = uint32(id)
+	}
+	for _, action := range event.Actions {
+		n.Actions = append(n.Actions, "action:"+action, action)
+	}
+	if event.RequestReplyId != "" && h.prompt != nil {
+		n.Actions = append(n.Actions, "reply", "Reply")
+	}
+	newId, err := h.notifier.Send(n, h)
+	if err != nil {
+		log.Println("Cannot show notification:", err)
+		return
+	}
+
+	h.ids[key] = newId
+	h.notifications[newId] = &remoteNotification{
+		device:         event.Device,
+		id:             event.NotificationBody.Id,
+		appName:        event.AppName,
+		ticker:         event.Ticker,
+		requestReplyId: event.RequestReplyId,
+	}
+}
+
+func (h *Notification) ActionInvoked(signal *notify.ActionInvokedSignal) {
+	// remoteNotification values are never modified, the lock is only needed
+	// for the lookup
+	h.Lock()
+	rn, ok := h.notifications[int(signal.Id)]
+	h.Unlock()
+	if !ok {
+		return
+	}
+
+	log.Println("Notification action:", rn.device.Name, rn.id, signal.ActionKey)
+
+	if signal.ActionKey == "reply" {
+		h.prompt("Reply to "+rn.appName, rn.ticker, func(message string) {
+			err := h.plugin.SendReply(rn.device, rn.requestReplyId, message)
+			if err != nil {
+				log.Println("Cannot send notification reply:", err)
+			}
+		})
+	} else if strings.HasPrefix(signal.ActionKey, "action:") {
+		action := strings.TrimPrefix(signal.ActionKey, "action:")
+		err := h.plugin.SendAction(rn.device, rn.id, action)
+		if err != nil {
+			log.Println("Cannot send notification action:", err)
+		}
+	}
+}
+
+func (h *Notification) NotificationClosed(signal *notify.NotificationClosedSignal) {
+	h.Lock()
+	defer h.Unlock()
+
+	rn, ok := h.notifications[int(signal.Id)]
+	if !ok {
+		return
+	}
+
+	delete(h.notifications, int(signal.Id))
+	delete(h.ids, notificationKey(rn.device, rn.id))
+
+	if signal.Reason == notify.ReasonDismissedByUser {
+		log.Println("Notification dismissed:", rn.device.Name, rn.id)
+
+		err := h.plugin.SendCancel(rn.device, rn.id)
+		if err != nil {
+			log.Println("Cannot send notification cancel:", err)
+		}
+	}
+}
+
+// NewNotification creates a new notification handler. prompt is used to ask
+// the user for quick replies, if nil replies are disabled.
+func NewNotification(p *plugins.Notification, notifier Notifier, prompt PromptFunc) *Notification {
+	return &Notification{
+		plugin:        p,
+		notifier:      notifier,
+		prompt:        prompt,
+		ids:           map[string]int{},
+		notifications: map[int]*remoteNotification{},
+	}
+}
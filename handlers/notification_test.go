@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"github.com/emersion/gnomeconnect/plugins"
+	"github.com/emersion/go-kdeconnect/network"
+	"testing"
+)
+
+func notificationEvent(device *network.Device, body plugins.NotificationBody) *plugins.NotificationEvent {
+	return &plugins.NotificationEvent{
+		Event:            plugins.Event{Device: device},
+		NotificationBody: body,
+	}
+}
+
+func TestNotification(t *testing.T) {
+	notifier := newFakeNotifier()
+	h := NewNotification(plugins.NewNotification(), notifier, nil)
+	device := newTestDevice("a")
+
+	h.handle(notificationEvent(device, plugins.NotificationBody{
+		Id:      "1",
+		AppName: "Messages",
+		Ticker:  "Hello",
+		Actions: []string{"Mark as read"},
+	}))
+	if notifier.count() != 1 {
+		t.Fatal("Expected a notification, got", notifier.count())
+	}
+
+	id := h.ids[notificationKey(device, "1")]
+	n, ok := notifier.get(id)
+	if !ok {
+		t.Fatal("Expected the notification to be open")
+	}
+	if n.Body != "Hello" {
+		t.Fatal("Invalid notification body:", n.Body)
+	}
+	if len(n.Actions) != 2 || n.Actions[0] != "action:Mark as read" {
+		t.Fatal("Invalid notification actions:", n.Actions)
+	}
+
+	// Updates replace the notification
+	h.handle(notificationEvent(device, plugins.NotificationBody{
+		Id:      "1",
+		AppName: "Messages",
+		Ticker:  "Hello again",
+	}))
+	if notifier.count() != 1 {
+		t.Fatal("Expected the notification to be replaced, got", notifier.count())
+	}
+	if n, _ := notifier.get(id); n.Body != "Hello again" {
+		t.Fatal("Expected the notification to be updated, got", n.Body)
+	}
+
+	// IDs are only unique per device
+	other := newTestDevice("b")
+	h.handle(notificationEvent(other, plugins.NotificationBody{Id: "1", Ticker: "Other"}))
+	if notifier.count() != 2 {
+		t.Fatal("Expected a notification per device, got", notifier.count())
+	}
+
+	h.handle(notificationEvent(device, plugins.NotificationBody{Id: "1", IsCancel: true}))
+	if _, ok := notifier.get(id); ok {
+		t.Fatal("Expected the notification to be closed")
+	}
+	if notifier.count() != 1 {
+		t.Fatal("Expected the other device's notification to stay open")
+	}
+}
+
+func TestNotification_reply(t *testing.T) {
+	notifier := newFakeNotifier()
+	device := newTestDevice("a")
+
+	var h *Notification
+	prompted := false
+	prompt := func(title, text string, send func(message string)) {
+		// The prompt must not be called with the lock held
+		h.Lock()
+		h.Unlock()
+
+		prompted = true
+		if text != "Hello" {
+			t.Error("Invalid prompt text:", text)
+		}
+	}
+	h = NewNotification(plugins.NewNotification(), notifier, prompt)
+
+	h.handle(notificationEvent(device, plugins.NotificationBody{
+		Id:             "1",
+		AppName:        "Messages",
+		Ticker:         "Hello",
+		RequestReplyId: "reply-1",
+	}))
+
+	id := h.ids[notificationKey(device, "1")]
+	n, _ := notifier.get(id)
+	if len(n.Actions) != 2 || n.Actions[0] != "reply" {
+		t.Fatal("Expected a reply action, got", n.Actions)
+	}
+
+	notifier.invoke(id, "reply")
+	if !prompted {
+		t.Fatal("Expected the user to be prompted for a reply")
+	}
+}
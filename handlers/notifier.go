@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"github.com/esiqveland/notify"
+	"github.com/godbus/dbus"
+	"sync"
+)
+
+// NewNotification returns a notification with GNOMEConnect's defaults.
+func NewNotification() notify.Notification {
+	return notify.Notification{
+		AppName: "GNOMEConnect",
+		Hints: map[string]dbus.Variant{
+			"desktop-entry": dbus.MakeVariant("gnomeconnect"),
+		},
+	}
+}
+
+// A NotificationListener receives the signals of the notifications it has
+// been registered for.
+type NotificationListener interface {
+	ActionInvoked(signal *notify.ActionInvokedSignal)
+	NotificationClosed(signal *notify.NotificationClosedSignal)
+}
+
+// A Notifier shows desktop notifications. Handlers only depend on this
+// interface, so that they can be used without a session bus.
+type Notifier interface {
+	// Send shows a notification and returns its ID. If l is not nil, it will
+	// receive the notification's signals.
+	Send(n notify.Notification, l NotificationListener) (int, error)
+	Close(id int) error
+}
+
+// DesktopNotifier is a Notifier using the desktop notification server.
+type DesktopNotifier struct {
+	notifier notify.Notifier
+
+	locker    sync.Mutex
+	listeners map[int]NotificationListener
+
+	// Signals of notifications sent without a listener.
+	Actions chan *notify.ActionInvokedSignal
+	Closed  chan *notify.NotificationClosedSignal
+}
+
+func (n *DesktopNotifier) Send(notification notify.Notification, l NotificationListener) (int, error) {
+	id, err := n.notifier.SendNotification(notification)
+	if err != nil {
+		return 0, err
+	}
+
+	n.locker.Lock()
+	if l != nil {
+		n.listeners[int(id)] = l
+	} else {
+		delete(n.listeners, int(id))
+	}
+	n.locker.Unlock()
+
+	return int(id), nil
+}
+
+func (n *DesktopNotifier) Close(id int) error {
+	_, err := n.notifier.CloseNotification(id)
+	return err
+}
+
+func (n *DesktopNotifier) listen() {
+	actions := n.notifier.ActionInvoked()
+	closed := n.notifier.NotificationClosed()
+
+	for {
+		select {
+		case signal := <-actions:
+			n.locker.Lock()
+			l := n.listeners[int(signal.Id)]
+			n.locker.Unlock()
+
+			if l != nil {
+				l.ActionInvoked(signal)
+			} else {
+				n.Actions <- signal
+			}
+		case signal := <-closed:
+			n.locker.Lock()
+			l := n.listeners[int(signal.Id)]
+			delete(n.listeners, int(signal.Id))
+			n.locker.Unlock()
+
+			if l != nil {
+				l.NotificationClosed(signal)
+			} else {
+				n.Closed <- signal
+			}
+		}
+	}
+}
+
+func NewDesktopNotifier(notifier notify.Notifier) *DesktopNotifier {
+	n := &DesktopNotifier{
+		notifier:  notifier,
+		listeners: map[int]NotificationListener{},
+		Actions:   make(chan *notify.ActionInvokedSignal),
+		Closed:    make(chan *notify.NotificationClosedSignal),
+	}
+
+	go n.listen()
+
+	return n
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"github.com/emersion/gnomeconnect/utils"
+	"github.com/emersion/go-kdeconnect/plugin"
+	"log"
+)
+
+type Ping struct {
+	base
+	plugin   *plugin.Ping
+	notifier Notifier
+}
+
+func (h *Ping) Name() string {
+	return "ping"
+}
+
+func (h *Ping) Start() {
+	h.start(h.listen)
+}
+
+func (h *Ping) Stop() {
+	h.stop(nil)
+}
+
+func (h *Ping) listen() {
+	for event := range h.plugin.Incoming {
+		h.Lock()
+		if h.enabled {
+			h.handle(event)
+		}
+		h.Unlock()
+	}
+}
+
+func (h *Ping) handle(event *plugin.PingEvent) {
+	log.Println("Ping:", event.Device.Name)
+
+	n := NewNotification()
+	n.AppIcon = utils.GetDeviceIcon(event.Device)
+	n.Summary = "Ping from " + event.Device.Name
+	h.notifier.Send(n, nil)
+}
+
+func NewPing(p *plugin.Ping, notifier Notifier) *Ping {
+	return &Ping{
+		plugin:   p,
+		notifier: notifier,
+	}
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/emersion/gnomeconnect/plugins"
+	"github.com/emersion/gnomeconnect/utils"
+	"github.com/emersion/go-kdeconnect/network"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// Commands are killed after this delay.
+const runCommandTimeout = 30 * time.Second
+
+// Only the end of the output of commands is shown.
+const runCommandMaxOutput = 500
+
+// tailBuffer keeps the last bytes written to it, up to max.
+type tailBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if n > b.max {
+		p = p[n-b.max:]
+	}
+	if extra := b.Len() + len(p) - b.max; extra > 0 {
+		b.Next(extra)
+	}
+	b.Buffer.Write(p)
+	return n, nil
+}
+
+// RunCommand runs commands requested by paired devices. Each device can only
+// run the commands listed in its file in the commands directory.
+type RunCommand struct {
+	base
+	plugin   *plugins.RunCommand
+	notifier Notifier
+	timeout  time.Duration
+}
+
+func (h *RunCommand) Name() string {
+	return "runcommand"
+}
+
+func (h *RunCommand) Start() {
+	h.start(h.listen)
+}
+
+func (h *RunCommand) Stop() {
+	h.stop(nil)
+}
+
+func (h *RunCommand) DeviceConnected(device *network.Device) {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.enabled {
+		h.sendCommandList(device)
+	}
+}
+
+func (h *RunCommand) DeviceDisconnected(device *network.Device) {}
+
+func (h *RunCommand) listen() {
+	for event := range h.plugin.Incoming {
+		h.Lock()
+		if h.enabled {
+			h.handle(event)
+		}
+		h.Unlock()
+	}
+}
+
+// loadCommands reads the commands a device can run.
+func loadCommands(device *network.Device) (map[string]*plugins.Command, error) {
+	commands := map[string]*plugins.Command{}
+
+	dir, err := utils.GetCommandsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	// Device IDs are chosen by devices, they must not be able to designate
+	// another file
+	name := strings.Replace(device.Id, "/", "_", -1) + ".json"
+	f, err := os.Open(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		return commands, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	err = json.NewDecoder(f).Decode(&commands)
+	return commands, err
+}
+
+func (h *RunCommand) sendCommandList(device *network.Device) {
+	commands, err := loadCommands(device)
+	if err != nil {
+		log.Println("Cannot load commands:", err)
+		return
+	}
+
+	if err := h.plugin.SendCommandList(device, commands); err != nil {
+		log.Println("Cannot send command list:", err)
+	}
+}
+
+func (h *RunCommand) handle(event *plugins.RunCommandEvent) {
+	log.Println("Run command:", event.Device.Name, event.RunCommandRequestBody)
+
+	if !event.Device.Paired {
+		log.Println("Warning: ignoring run command request from unpaired device", event.Device.Name)
+		return
+	}
+
+	if event.RequestCommandList {
+		h.sendCommandList(event.Device)
+	}
+
+	if event.Key == "" {
+		return
+	}
+
+	commands, err := loadCommands(event.Device)
+	if err != nil {
+		log.Println("Cannot load commands:", err)
+		return
+	}
+
+	command, ok := commands[event.Key]
+	if !ok {
+		log.Println("Warning: unknown command requested by", event.Device.Name, event.Key)
+		return
+	}
+
+	// Commands can take a while, don't block other events
+	go h.run(event.Device, command)
+}
+
+func (h *RunCommand) run(device *network.Device, command *plugins.Command) {
+	// Stdout and stderr share the same pipe, output is only read after Wait.
+	// Keep a bit more than what is shown, leading whitespace is trimmed.
+	output := &tailBuffer{max: 2 * runCommandMaxOutput}
+	cmd := exec.Command("sh", "-c", command.Command)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	// Run the command in its own process group, so that children started by
+	// the shell are killed too and don't keep the output pipe open
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	n := NewNotification()
+	n.AppIcon = utils.GetDeviceIcon(device)
+
+	if err := cmd.Start(); err != nil {
+		log.Println("Cannot run command:", err)
+		n.Summary = "Cannot run " + command.Name
+		n.Body = err.Error()
+		h.notifier.Send(n, nil)
+		return
+	}
+
+	var locker sync.Mutex
+	timedOut := false
+	timer := time.AfterFunc(h.timeout, func() {
+		locker.Lock()
+		timedOut = true
+		locker.Unlock()
+
+		if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+			log.Println("Cannot kill command:", err)
+		}
+	})
+
+	err := cmd.Wait()
+	timer.Stop()
+
+	locker.Lock()
+	defer locker.Unlock()
+
+	switch {
+	case timedOut:
+		n.Summary = command.Name + " timed out"
+	case err != nil:
+		n.Summary = command.Name + " failed (" + err.Error() + ")"
+	default:
+		n.Summary = command.Name + " finished"
+	}
+	log.Println("Run command:", device.Name, n.Summary)
+
+	body := strings.TrimSpace(output.String())
+	if len(body) > runCommandMaxOutput {
+		body = body[len(body)-runCommandMaxOutput:]
+		// Don't start in the middle of a character
+		for len(body) > 0 && !utf8.RuneStart(body[0]) {
+			body = body[1:]
+		}
+		body = "…" + body
+	}
+	n.Body = body
+
+	h.notifier.Send(n, nil)
+}
+
+func NewRunCommand(p *plugins.RunCommand, notifier Notifier) *RunCommand {
+	return &RunCommand{
+		plugin:   p,
+		notifier: notifier,
+		timeout:  runCommandTimeout,
+	}
+}
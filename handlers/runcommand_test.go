@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"github.com/emersion/gnomeconnect/plugins"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{max: 10}
+
+	b.Write([]byte("Hello"))
+	if b.String() != "Hello" {
+		t.Fatal("Expected the buffer to keep short writes, got", b.String())
+	}
+
+	b.Write([]byte(", world!"))
+	if b.String() != "lo, world!" {
+		t.Fatal("Expected the buffer to keep the last bytes, got", b.String())
+	}
+
+	n, err := b.Write(bytes.Repeat([]byte("a"), 100))
+	if n != 100 || err != nil {
+		t.Fatal("Expected the whole write to be accepted, got", n, err)
+	}
+	if b.String() != strings.Repeat("a", 10) {
+		t.Fatal("Expected the buffer to keep the end of a long write, got", b.String())
+	}
+
+	for i := 0; i < 1000; i++ {
+		b.Write([]byte("0123456789"))
+	}
+	if b.Len() != 10 || b.Cap() > 1024 {
+		t.Fatal("Expected the buffer to stay small, got", b.Len(), b.Cap())
+	}
+}
+
+func newTestRunCommand() (*RunCommand, *fakeNotifier) {
+	notifier := newFakeNotifier()
+	return NewRunCommand(plugins.NewRunCommand(), notifier), notifier
+}
+
+func TestRunCommand_run(t *testing.T) {
+	h, notifier := newTestRunCommand()
+
+	h.run(newTestDevice("a"), &plugins.Command{
+		Name:    "Hello",
+		Command: "echo Hello; echo world >&2",
+	})
+
+	n, ok := notifier.get(1)
+	if !ok {
+		t.Fatal("Expected a notification")
+	}
+	if n.Summary != "Hello finished" {
+		t.Fatal("Invalid notification summary:", n.Summary)
+	}
+	if n.Body != "Hello\nworld" {
+		t.Fatalf("Invalid notification body: %q", n.Body)
+	}
+}
+
+func TestRunCommand_run_output(t *testing.T) {
+	h, notifier := newTestRunCommand()
+
+	h.run(newTestDevice("a"), &plugins.Command{
+		Name:    "Verbose",
+		Command: "i=0; while [ $i -lt 1000 ]; do echo line $i; i=$((i+1)); done; echo end",
+	})
+
+	n, _ := notifier.get(1)
+	if !strings.HasPrefix(n.Body, "…") || !strings.HasSuffix(n.Body, "line 999\nend") {
+		t.Fatalf("Expected the end of the output, got %q", n.Body)
+	}
+	if len(n.Body) > runCommandMaxOutput+len("…") {
+		t.Fatal("Expected the output to be truncated, got length", len(n.Body))
+	}
+}
+
+func TestRunCommand_run_timeout(t *testing.T) {
+	h, notifier := newTestRunCommand()
+	h.timeout = 100 * time.Millisecond
+
+	// The background child keeps the output pipe open, it must be killed
+	// with the shell
+	start := time.Now()
+	h.run(newTestDevice("a"), &plugins.Command{
+		Name:    "Sleep",
+		Command: "sleep 60 & sleep 60",
+	})
+	if d := time.Since(start); d > 30*time.Second {
+		t.Fatal("Expected the command to be killed on timeout, it ran for", d)
+	}
+
+	n, _ := notifier.get(1)
+	if n.Summary != "Sleep timed out" {
+		t.Fatal("Invalid notification summary:", n.Summary)
+	}
+}
+
+func TestLoadCommands(t *testing.T) {
+	configHome, err := ioutil.TempDir("", "gnomeconnect-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(configHome)
+
+	oldConfigHome := os.Getenv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_CONFIG_HOME", configHome)
+	defer os.Setenv("XDG_CONFIG_HOME", oldConfigHome)
+
+	configDir := filepath.Join(configHome, "gnomeconnect")
+	commandsDir := filepath.Join(configDir, "commands")
+	if err := os.MkdirAll(commandsDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	commands := []byte(`{"hello": {"name": "Hello", "command": "echo Hello"}}`)
+	if err := ioutil.WriteFile(filepath.Join(commandsDir, "a.json"), commands, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Outside of the commands directory
+	if err := ioutil.WriteFile(filepath.Join(configDir, "evil.json"), commands, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadCommands(newTestDevice("a"))
+	if err != nil {
+		t.Fatal("Expected no error when loading commands, got", err)
+	}
+	if c, ok := loaded["hello"]; !ok || c.Command != "echo Hello" {
+		t.Fatalf("Invalid loaded commands: %+v", loaded)
+	}
+
+	loaded, err = loadCommands(newTestDevice("../evil"))
+	if err != nil {
+		t.Fatal("Expected no error when loading commands, got", err)
+	}
+	if len(loaded) != 0 {
+		t.Fatalf("Expected devices not to load commands outside of the commands directory, got %+v", loaded)
+	}
+}
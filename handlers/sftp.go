@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"github.com/emersion/gnomeconnect/utils"
+	"github.com/emersion/go-kdeconnect/plugin"
+	"log"
+)
+
+type Sftp struct {
+	base
+	plugin *plugin.Sftp
+}
+
+func (h *Sftp) Name() string {
+	return "sftp"
+}
+
+func (h *Sftp) Start() {
+	h.start(h.listen)
+}
+
+func (h *Sftp) Stop() {
+	h.stop(nil)
+}
+
+func (h *Sftp) listen() {
+	for event := range h.plugin.Incoming {
+		h.Lock()
+		if h.enabled {
+			h.handle(event)
+		}
+		h.Unlock()
+	}
+}
+
+func (h *Sftp) handle(event *plugin.SftpEvent) {
+	log.Println("Sftp:", event.Device.Name, event.SftpBody)
+
+	// Mounting can take a while, don't block other events
+	go utils.MountSftp(event.Ip, event.Port, event.User, event.Password)
+}
+
+func NewSftp(p *plugin.Sftp) *Sftp {
+	return &Sftp{plugin: p}
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/emersion/gnomeconnect/plugins"
+	"github.com/emersion/gnomeconnect/utils"
+	"github.com/emersion/go-kdeconnect/network"
+	"github.com/esiqveland/notify"
+	"github.com/godbus/dbus"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var ErrHandlerDisabled = errors.New("Handler is disabled")
+
+// A ClipboardFunc replaces the content of the clipboard. It must not block,
+// and is called without the handler's lock held.
+type ClipboardFunc func(text string)
+
+// sharedItem is something received from a device which can be opened from a
+// notification.
+type sharedItem struct {
+	url    string
+	folder string
+}
+
+type Share struct {
+	base
+	plugin    *plugins.Share
+	notifier  Notifier
+	settings  *utils.Settings
+	clipboard ClipboardFunc
+
+	// Maps notification IDs to received items
+	items map[int]*sharedItem
+}
+
+func (h *Share) Name() string {
+	return "share"
+}
+
+func (h *Share) Start() {
+	h.start(h.listen)
+}
+
+func (h *Share) Stop() {
+	h.stop(func() {
+		for id := range h.items {
+			h.notifier.Close(id)
+		}
+		h.items = map[int]*sharedItem{}
+	})
+}
+
+func (h *Share) listen() {
+	for event := range h.plugin.Incoming {
+		if event.Filename == "" && event.Url == "" && event.Text != "" {
+			// Text doesn't need the handler's state, and the lock must not be
+			// held while calling into the UI
+			if h.Enabled() {
+				h.shareText(event)
+			}
+			continue
+		}
+
+		h.Lock()
+		if h.enabled {
+			h.handle(event)
+		}
+		h.Unlock()
+	}
+}
+
+func (h *Share) handle(event *plugins.ShareEvent) {
+	log.Println("Share:", event.Device.Name, event.ShareBody)
+
+	switch {
+	case event.Filename != "":
+		// Downloading can take a while, don't block other events
+		go h.receiveFile(event)
+	case event.Url != "":
+		n := NewNotification()
+		n.AppIcon = utils.GetDeviceIcon(event.Device)
+		n.Summary = "Link from " + event.Device.Name
+		n.Body = event.Url
+		n.Actions = []string{"default", "Open", "open", "Open link"}
+		id, err := h.notifier.Send(n, h)
+		if err != nil {
+			log.Println("Cannot show notification:", err)
+			return
+		}
+
+		h.items[id] = &sharedItem{url: event.Url}
+	}
+}
+
+func (h *Share) shareText(event *plugins.ShareEvent) {
+	log.Println("Share:", event.Device.Name, "text")
+
+	h.clipboard(event.Text)
+
+	n := NewNotification()
+	n.AppIcon = utils.GetDeviceIcon(event.Device)
+	n.Summary = "Text from " + event.Device.Name + " copied to clipboard"
+	n.Body = event.Text
+	h.notifier.Send(n, nil)
+}
+
+func (h *Share) receiveFile(event *plugins.ShareEvent) {
+	path, err := h.saveFile(event)
+
+	n := NewNotification()
+	n.AppIcon = utils.GetDeviceIcon(event.Device)
+	if err != nil {
+		log.Println("Cannot receive file:", err)
+		n.Hints["category"] = dbus.MakeVariant("transfer.error")
+		n.Summary = "Cannot receive " + filepath.Base(event.Filename) + " from " + event.Device.Name
+		n.Body = err.Error()
+		h.notifier.Send(n, nil)
+		return
+	}
+
+	n.Hints["category"] = dbus.MakeVariant("transfer.complete")
+	n.Summary = filepath.Base(path) + " received from " + event.Device.Name
+	n.Body = path
+	n.Actions = []string{"default", "Open", "open", "Open", "open-folder", "Open folder"}
+
+	h.Lock()
+	defer h.Unlock()
+
+	id, err := h.notifier.Send(n, h)
+	if err != nil {
+		log.Println("Cannot show notification:", err)
+		return
+	}
+
+	h.items[id] = &sharedItem{
+		url:    path,
+		folder: filepath.Dir(path),
+	}
+}
+
+// saveFile downloads a shared file to the download directory and returns its
+// path.
+func (h *Share) saveFile(event *plugins.ShareEvent) (string, error) {
+	dir, err := utils.GetDownloadDir(h.settings)
+	if err != nil {
+		return "", err
+	}
+
+	r, err := h.plugin.Receive(event)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	f, err := utils.CreateUniqueFile(dir, event.Filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, r)
+	if err == nil && n != event.PayloadSize {
+		// The device closed the connection before sending the whole file
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+func (h *Share) ActionInvoked(signal *notify.ActionInvokedSignal) {
+	h.Lock()
+	defer h.Unlock()
+
+	item, ok := h.items[int(signal.Id)]
+	if !ok {
+		return
+	}
+
+	url := item.url
+	if signal.ActionKey == "open-folder" {
+		url = item.folder
+	}
+
+	if err := utils.OpenUrl(url); err != nil {
+		log.Println("Cannot open shared item:", err)
+	}
+}
+
+func (h *Share) NotificationClosed(signal *notify.NotificationClosedSignal) {
+	h.Lock()
+	defer h.Unlock()
+
+	delete(h.items, int(signal.Id))
+}
+
+// SendFile sends a file to a device, showing the progress in a notification.
+func (h *Share) SendFile(device *network.Device, path string) error {
+	if !h.Enabled() {
+		return ErrHandlerDisabled
+	}
+
+	name := filepath.Base(path)
+
+	n := NewNotification()
+	n.AppIcon = utils.GetDeviceIcon(device)
+	n.Summary = "Sending " + name + " to " + device.Name
+	n.Hints["category"] = dbus.MakeVariant("transfer")
+	n.Hints["value"] = dbus.MakeVariant(int32(0))
+	id, _ := h.notifier.Send(n, nil)
+
+	var locker sync.Mutex
+	var size int64
+	percent := 0
+	progress := func(written int64) {
+		locker.Lock()
+		defer locker.Unlock()
+
+		if size == 0 || int(written*100/size) == percent {
+			return
+		}
+		percent = int(written * 100 / size)
+
+		n.ReplacesID = uint32(id)
+		n.Hints["value"] = dbus.MakeVariant(int32(percent))
+		h.notifier.Send(n, nil)
+	}
+
+	transfer, err := h.plugin.SendFile(device, path, progress)
+	if err != nil {
+		h.notifier.Close(id)
+		return err
+	}
+
+	locker.Lock()
+	size = transfer.Size
+	locker.Unlock()
+
+	go func() {
+		<-transfer.Done()
+
+		locker.Lock()
+		defer locker.Unlock()
+
+		done := NewNotification()
+		done.AppIcon = utils.GetDeviceIcon(device)
+		done.ReplacesID = uint32(id)
+		if err := transfer.Err(); err != nil {
+			log.Println("Cannot send file:", err)
+			done.Hints["category"] = dbus.MakeVariant("transfer.error")
+			done.Summary = "Cannot send " + name + " to " + device.Name
+			done.Body = err.Error()
+		} else {
+			done.Hints["category"] = dbus.MakeVariant("transfer.complete")
+			done.Summary = name + " sent to " + device.Name
+		}
+		h.notifier.Send(done, nil)
+	}()
+
+	return nil
+}
+
+func NewShare(p *plugins.Share, notifier Notifier, settings *utils.Settings, clipboard ClipboardFunc) *Share {
+	return &Share{
+		plugin:    p,
+		notifier:  notifier,
+		settings:  settings,
+		clipboard: clipboard,
+		items:     map[int]*sharedItem{},
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"github.com/emersion/gnomeconnect/conversations"
+	"github.com/emersion/gnomeconnect/plugins"
+	"log"
+	"time"
+)
+
+// Sms saves conversations synchronized from devices.
+type Sms struct {
+	base
+	plugin *plugins.Sms
+	store  *conversations.Store
+}
+
+func (h *Sms) Name() string {
+	return "sms"
+}
+
+func (h *Sms) Start() {
+	h.start(h.listen)
+}
+
+func (h *Sms) Stop() {
+	h.stop(nil)
+}
+
+func (h *Sms) listen() {
+	for event := range h.plugin.Incoming {
+		h.Lock()
+		if h.enabled {
+			h.handle(event)
+		}
+		h.Unlock()
+	}
+}
+
+func (h *Sms) handle(event *plugins.SmsMessagesEvent) {
+	log.Println("Sms:", event.Device.Name, len(event.Messages), "messages")
+
+	messages := make([]*conversations.Message, 0, len(event.Messages))
+	for _, m := range event.Messages {
+		if m.Type != plugins.SmsMessageTypeInbox && m.Type != plugins.SmsMessageTypeSent {
+			// Drafts, outbox...
+			continue
+		}
+
+		messages = append(messages, &conversations.Message{
+			Id:       m.Id,
+			ThreadId: m.ThreadId,
+			Address:  m.GetAddress(),
+			Body:     m.Body,
+			Date:     time.Unix(0, m.Date*int64(time.Millisecond)),
+			Sent:     m.Type == plugins.SmsMessageTypeSent,
+		})
+	}
+
+	if err := h.store.Add(event.Device.Id, messages...); err != nil {
+		log.Println("Cannot save conversations:", err)
+	}
+}
+
+func NewSms(p *plugins.Sms, store *conversations.Store) *Sms {
+	return &Sms{
+		plugin: p,
+		store:  store,
+	}
+}
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"github.com/emersion/gnomeconnect/contacts"
+	"github.com/emersion/gnomeconnect/conversations"
+	"github.com/emersion/gnomeconnect/plugins"
+	"github.com/emersion/gnomeconnect/utils"
+	"github.com/emersion/go-kdeconnect/network"
+	"github.com/emersion/go-kdeconnect/plugin"
+	"github.com/esiqveland/notify"
+	"github.com/godbus/dbus"
+	"log"
+	"time"
+)
+
+type CallState int
+
+const (
+	CallRinging CallState = iota
+	CallTalking
+	CallMissed
+	CallEnded
+)
+
+// A Call is an entry of the call history.
+type Call struct {
+	Device      *network.Device
+	PhoneNumber string
+	ContactName string
+	State       CallState
+	// Time at which the call started ringing
+	Start time.Time
+	// Time at which the call ended, zero if it's still active
+	End time.Time
+}
+
+// A CallObserver is notified when calls start and end.
+type CallObserver interface {
+	CallStarted(call *Call)
+	CallEnded(call *Call)
+}
+
+// An smsNotification is a notification for a received SMS.
+type smsNotification struct {
+	device      *network.Device
+	phoneNumber string
+	contactName string
+	message     string
+}
+
+type activeCall struct {
+	*Call
+	notification int
+	// Whether observers have been told that the call started
+	observed bool
+}
+
+type Telephony struct {
+	base
+	plugin   *plugin.Telephony
+	notifier Notifier
+	contacts *contacts.Resolver
+	store    *conversations.Store
+	prompt   PromptFunc
+
+	observers []CallObserver
+	sms       map[int]*smsNotification
+
+	// Active calls, by device ID and phone number
+	calls   map[string]map[string]*activeCall
+	history []*Call
+}
+
+func (h *Telephony) Name() string {
+	return "telephony"
+}
+
+func (h *Telephony) Start() {
+	h.start(h.listen)
+}
+
+func (h *Telephony) Stop() {
+	h.stop(func() {
+		for _, calls := range h.calls {
+			for _, call := range calls {
+				h.endCall(call, CallEnded)
+			}
+		}
+
+		for id := range h.sms {
+			h.notifier.Close(id)
+		}
+		h.sms = map[int]*smsNotification{}
+	})
+}
+
+func (h *Telephony) listen() {
+	for event := range h.plugin.Incoming {
+		h.Lock()
+		if h.enabled {
+			h.handle(event)
+		}
+		h.Unlock()
+	}
+}
+
+// endCall removes a call from active calls and closes its notification.
+func (h *Telephony) endCall(call *activeCall, state CallState) {
+	call.State = state
+	call.End = time.Now()
+
+	if call.notification != 0 {
+		h.notifier.Close(call.notification)
+		call.notification = 0
+	}
+
+	calls := h.calls[call.Device.Id]
+	delete(calls, call.PhoneNumber)
+	if len(calls) == 0 {
+		delete(h.calls, call.Device.Id)
+	}
+
+	if call.observed {
+		for _, o := range h.observers {
+			o.CallEnded(call.Call)
+		}
+	}
+}
+
+func (h *Telephony) handle(event *plugin.TelephonyEvent) {
+	log.Println("Telephony:", event.Device.Name, event.TelephonyBody)
+
+	contactName := h.contacts.Resolve(event.PhoneNumber, event.ContactName)
+
+	if event.TelephonyBody.Event == plugin.TelephonySms {
+		n := NewNotification()
+		n.AppIcon = utils.GetDeviceIcon(event.Device)
+		n.Hints["category"] = dbus.MakeVariant("im.received")
+		n.Summary = "SMS from " + contactName + " on " + event.Device.Name
+		n.Body = event.MessageBody
+		if event.PhoneNumber != "" && h.prompt != nil {
+			n.Actions = []string{"reply", "Reply"}
+		}
+		err := h.store.Add(event.Device.Id, &conversations.Message{
+			Address: event.PhoneNumber,
+			Body:    event.MessageBody,
+			Date:    time.Now(),
+		})
+		if err != nil {
+			log.Println("Cannot save SMS:", err)
+		}
+
+		id, err := h.notifier.Send(n, h)
+		if err == nil {
+			h.sms[id] = &smsNotification{
+				device:      event.Device,
+				phoneNumber: event.PhoneNumber,
+				contactName: contactName,
+				message:     event.MessageBody,
+			}
+		}
+		return
+	}
+
+	calls := h.calls[event.Device.Id]
+
+	if event.IsCancel {
+		if event.PhoneNumber == "" {
+			// Unknown number, end all calls of this device
+			for _, call := range calls {
+				h.endCall(call, CallEnded)
+			}
+		} else if call, ok := calls[event.PhoneNumber]; ok {
+			h.endCall(call, CallEnded)
+		}
+		return
+	}
+
+	call, ok := calls[event.PhoneNumber]
+	if !ok {
+		call = &activeCall{
+			Call: &Call{
+				Device:      event.Device,
+				PhoneNumber: event.PhoneNumber,
+				Start:       time.Now(),
+			},
+		}
+		h.history = append(h.history, call.Call)
+
+		if calls == nil {
+			calls = map[string]*activeCall{}
+			h.calls[event.Device.Id] = calls
+		}
+		calls[event.PhoneNumber] = call
+
+		// Calls we only learn about once missed never started for observers
+		if event.TelephonyBody.Event != plugin.TelephonyMissedCall {
+			call.observed = true
+			for _, o := range h.observers {
+				o.CallStarted(call.Call)
+			}
+		}
+	}
+	call.ContactName = contactName
+
+	n := NewNotification()
+	n.Hints["category"] = dbus.MakeVariant("im")
+	if call.notification != 0 {
+		n.ReplacesID = uint32(call.notification)
+	}
+
+	switch event.TelephonyBody.Event {
+	case plugin.TelephonyRinging:
+		call.State = CallRinging
+		n.AppIcon = "call-start"
+		n.Summary = "Call from " + contactName + " on " + event.Device.Name
+		n.Actions = []string{
+			plugins.TelephonyActionMute, "Mute ringer",
+			plugins.TelephonyActionReject, "Reject",
+		}
+	case plugin.TelephonyTalking:
+		call.State = CallTalking
+		n.AppIcon = "call-start"
+		n.Summary = "Calling " + contactName + " on " + event.Device.Name
+	case plugin.TelephonyMissedCall:
+		call.State = CallMissed
+		n.AppIcon = "call-stop"
+		n.Summary = "Missed call from " + contactName + " on " + event.Device.Name
+	}
+
+	id, _ := h.notifier.Send(n, h)
+	call.notification = id
+
+	if call.State == CallMissed {
+		// Keep the missed call notification, the call is over
+		call.notification = 0
+		h.endCall(call, CallMissed)
+	}
+}
+
+func (h *Telephony) callFromNotification(id int) *activeCall {
+	for _, calls := range h.calls {
+		for _, call := range calls {
+			if call.notification == id {
+				return call
+			}
+		}
+	}
+	return nil
+}
+
+func (h *Telephony) ActionInvoked(signal *notify.ActionInvokedSignal) {
+	// Only look up the notification with the lock held, prompting the user
+	// and sending packages is done without it
+	h.Lock()
+	sms, isSms := h.sms[int(signal.Id)]
+	var device *network.Device
+	var phoneNumber string
+	if call := h.callFromNotification(int(signal.Id)); call != nil {
+		device = call.Device
+		phoneNumber = call.PhoneNumber
+	}
+	h.Unlock()
+
+	if isSms {
+		if signal.ActionKey == "reply" {
+			h.prompt("Reply to "+sms.contactName, sms.message, func(message string) {
+				err := plugins.SendSms(sms.device, sms.phoneNumber, message)
+				if err != nil {
+					log.Println("Cannot send SMS:", err)
+					return
+				}
+
+				err = h.store.Add(sms.device.Id, &conversations.Message{
+					Address: sms.phoneNumber,
+					Body:    message,
+					Date:    time.Now(),
+					Sent:    true,
+				})
+				if err != nil {
+					log.Println("Cannot save SMS:", err)
+				}
+			})
+		}
+		return
+	}
+
+	if device == nil {
+		return
+	}
+
+	switch signal.ActionKey {
+	case plugins.TelephonyActionMute, plugins.TelephonyActionReject:
+		log.Println("Telephony action:", device.Name, phoneNumber, signal.ActionKey)
+
+		err := plugins.SendTelephonyAction(device, signal.ActionKey)
+		if err != nil {
+			log.Println("Cannot send telephony action:", err)
+		}
+	}
+}
+
+func (h *Telephony) NotificationClosed(signal *notify.NotificationClosedSignal) {
+	h.Lock()
+	defer h.Unlock()
+
+	delete(h.sms, int(signal.Id))
+
+	if call := h.callFromNotification(int(signal.Id)); call != nil {
+		call.notification = 0
+	}
+}
+
+// Observe registers an observer for call events.
+func (h *Telephony) Observe(o CallObserver) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.observers = append(h.observers, o)
+}
+
+// History returns all calls received during this session, oldest first.
+func (h *Telephony) History() []Call {
+	h.Lock()
+	defer h.Unlock()
+
+	history := make([]Call, len(h.history))
+	for i, call := range h.history {
+		history[i] = *call
+	}
+	return history
+}
+
+// NewTelephony creates a new telephony handler. prompt is used to reply to
+// SMS, if nil replies are disabled.
+func NewTelephony(p *plugin.Telephony, notifier Notifier, resolver *contacts.Resolver, store *conversations.Store, prompt PromptFunc) *Telephony {
+	return &Telephony{
+		plugin:   p,
+		notifier: notifier,
+		contacts: resolver,
+		store:    store,
+		prompt:   prompt,
+		sms:      map[int]*smsNotification{},
+		calls:    map[string]map[string]*activeCall{},
+	}
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"github.com/emersion/gnomeconnect/contacts"
+	"github.com/emersion/gnomeconnect/conversations"
+	"github.com/emersion/go-kdeconnect/network"
+	"github.com/emersion/go-kdeconnect/plugin"
+	"testing"
+)
+
+func telephonyEvent(device *network.Device, body plugin.TelephonyBody) *plugin.TelephonyEvent {
+	return &plugin.TelephonyEvent{
+		Event:         plugin.Event{Device: device},
+		TelephonyBody: body,
+	}
+}
+
+// callRecorder is a CallObserver recording calls.
+type callRecorder struct {
+	started []*Call
+	ended   []*Call
+}
+
+func (r *callRecorder) CallStarted(call *Call) {
+	r.started = append(r.started, call)
+}
+
+func (r *callRecorder) CallEnded(call *Call) {
+	r.ended = append(r.ended, call)
+}
+
+func newTestTelephony() (*Telephony, *fakeNotifier, *callRecorder) {
+	notifier := newFakeNotifier()
+	h := NewTelephony(plugin.NewTelephony(), notifier, contacts.NewResolver(), conversations.NewStore(""), nil)
+	recorder := &callRecorder{}
+	h.Observe(recorder)
+	return h, notifier, recorder
+}
+
+func TestTelephony_ringingThenTalking(t *testing.T) {
+	h, notifier, recorder := newTestTelephony()
+	device := newTestDevice("a")
+
+	h.handle(telephonyEvent(device, plugin.TelephonyBody{Event: plugin.TelephonyRinging, PhoneNumber: "+33612345678"}))
+	if notifier.count() != 1 {
+		t.Fatal("Expected a ringing notification, got", notifier.count())
+	}
+
+	h.handle(telephonyEvent(device, plugin.TelephonyBody{Event: plugin.TelephonyTalking, PhoneNumber: "+33612345678"}))
+	if notifier.count() != 1 {
+		t.Fatal("Expected the ringing notification to be replaced, got", notifier.count())
+	}
+	if len(recorder.started) != 1 {
+		t.Fatal("Expected a single started call, got", len(recorder.started))
+	}
+
+	h.handle(telephonyEvent(device, plugin.TelephonyBody{Event: plugin.TelephonyTalking, PhoneNumber: "+33612345678", IsCancel: true}))
+	if notifier.count() != 0 {
+		t.Fatal("Expected the call notification to be closed")
+	}
+	if len(recorder.ended) != 1 || recorder.ended[0].State != CallEnded {
+		t.Fatal("Expected the call to be ended")
+	}
+}
+
+func TestTelephony_perDevice(t *testing.T) {
+	h, notifier, recorder := newTestTelephony()
+	a := newTestDevice("a")
+	b := newTestDevice("b")
+
+	// The same number calls both devices, e.g. a phone and a tablet
+	h.handle(telephonyEvent(a, plugin.TelephonyBody{Event: plugin.TelephonyRinging, PhoneNumber: "+33612345678"}))
+	h.handle(telephonyEvent(b, plugin.TelephonyBody{Event: plugin.TelephonyRinging, PhoneNumber: "+33612345678"}))
+	if notifier.count() != 2 {
+		t.Fatal("Expected one notification per device, got", notifier.count())
+	}
+	if len(recorder.started) != 2 {
+		t.Fatal("Expected one call per device, got", len(recorder.started))
+	}
+
+	h.handle(telephonyEvent(a, plugin.TelephonyBody{Event: plugin.TelephonyRinging, PhoneNumber: "+33612345678", IsCancel: true}))
+	if notifier.count() != 1 {
+		t.Fatal("Expected only the first device's call to end, got", notifier.count())
+	}
+	if len(recorder.ended) != 1 || recorder.ended[0].Device != a {
+		t.Fatal("Expected the first device's call to end")
+	}
+}
+
+func TestTelephony_perNumber(t *testing.T) {
+	h, notifier, recorder := newTestTelephony()
+	device := newTestDevice("a")
+
+	// A second call rings during the first one
+	h.handle(telephonyEvent(device, plugin.TelephonyBody{Event: plugin.TelephonyTalking, PhoneNumber: "+33612345678"}))
+	h.handle(telephonyEvent(device, plugin.TelephonyBody{Event: plugin.TelephonyRinging, PhoneNumber: "+33687654321"}))
+	if notifier.count() != 2 {
+		t.Fatal("Expected one notification per call, got", notifier.count())
+	}
+
+	h.handle(telephonyEvent(device, plugin.TelephonyBody{Event: plugin.TelephonyRinging, PhoneNumber: "+33687654321", IsCancel: true}))
+	if notifier.count() != 1 {
+		t.Fatal("Expected only the second call to end, got", notifier.count())
+	}
+	if len(recorder.ended) != 1 || recorder.ended[0].PhoneNumber != "+33687654321" {
+		t.Fatal("Expected the second call to end")
+	}
+
+	// A cancel without number ends all calls of the device
+	h.handle(telephonyEvent(device, plugin.TelephonyBody{Event: plugin.TelephonyRinging, PhoneNumber: "+33687654321"}))
+	h.handle(telephonyEvent(device, plugin.TelephonyBody{Event: plugin.TelephonyTalking, PhoneNumber: "", IsCancel: true}))
+	if notifier.count() != 0 {
+		t.Fatal("Expected all calls to end, got", notifier.count())
+	}
+	if len(recorder.ended) != 3 {
+		t.Fatal("Expected three ended calls, got", len(recorder.ended))
+	}
+}
+
+func TestTelephony_missedCall(t *testing.T) {
+	h, notifier, recorder := newTestTelephony()
+	device := newTestDevice("a")
+
+	h.handle(telephonyEvent(device, plugin.TelephonyBody{Event: plugin.TelephonyRinging, PhoneNumber: "+33612345678"}))
+	h.handle(telephonyEvent(device, plugin.TelephonyBody{Event: plugin.TelephonyMissedCall, PhoneNumber: "+33612345678"}))
+
+	if notifier.count() != 1 {
+		t.Fatal("Expected the missed call notification to stay open, got", notifier.count())
+	}
+	if len(recorder.ended) != 1 || recorder.ended[0].State != CallMissed {
+		t.Fatal("Expected the call to be missed")
+	}
+
+	// A late cancel for the missed call doesn't close its notification
+	h.handle(telephonyEvent(device, plugin.TelephonyBody{Event: plugin.TelephonyMissedCall, PhoneNumber: "+33612345678", IsCancel: true}))
+	if notifier.count() != 1 {
+		t.Fatal("Expected the missed call notification to stay open")
+	}
+
+	history := h.History()
+	if len(history) != 1 || history[0].State != CallMissed || history[0].End.IsZero() {
+		t.Fatalf("Invalid call history: %+v", history)
+	}
+}
+
+func TestTelephony_missedCallOnly(t *testing.T) {
+	h, notifier, recorder := newTestTelephony()
+	device := newTestDevice("a")
+
+	// No ringing event was received before the missed call
+	h.handle(telephonyEvent(device, plugin.TelephonyBody{Event: plugin.TelephonyMissedCall, PhoneNumber: "+33612345678"}))
+
+	if notifier.count() != 1 {
+		t.Fatal("Expected a missed call notification, got", notifier.count())
+	}
+	if len(recorder.started) != 0 || len(recorder.ended) != 0 {
+		t.Fatal("Expected observers not to be notified of a missed call")
+	}
+
+	history := h.History()
+	if len(history) != 1 || history[0].State != CallMissed {
+		t.Fatalf("Invalid call history: %+v", history)
+	}
+}
+
+func TestTelephony_sms(t *testing.T) {
+	h, notifier, _ := newTestTelephony()
+	device := newTestDevice("a")
+
+	event := telephonyEvent(device, plugin.TelephonyBody{Event: plugin.TelephonySms, PhoneNumber: "+33612345678"})
+	event.MessageBody = "Hello"
+	h.handle(event)
+
+	if notifier.count() != 1 {
+		t.Fatal("Expected an SMS notification, got", notifier.count())
+	}
+
+	convs := h.store.Conversations(device.Id)
+	if len(convs) != 1 || len(convs[0].Messages) != 1 || convs[0].Messages[0].Body != "Hello" {
+		t.Fatalf("Expected the SMS to be stored, got %+v", convs)
+	}
+}
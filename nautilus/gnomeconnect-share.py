@@ -0,0 +1,81 @@
+# Nautilus extension adding a "Send to device" menu to local files. It lists
+# the connected paired devices of the running GNOMEConnect instance, and sends
+# files through its D-Bus service.
+#
+# Requires nautilus-python. Install it in ~/.local/share/nautilus-python/extensions.
+
+from gi.repository import Gio, GLib, GObject, Nautilus
+
+BUS_NAME = 'org.gnomeconnect.Daemon'
+DAEMON_PATH = '/org/gnomeconnect/Daemon'
+DAEMON_INTERFACE = 'org.gnomeconnect.Daemon'
+DEVICE_INTERFACE = 'org.gnomeconnect.Device'
+PROPERTIES_INTERFACE = 'org.freedesktop.DBus.Properties'
+
+
+class GnomeConnectShareExtension(GObject.GObject, Nautilus.MenuProvider):
+    def __init__(self):
+        GObject.GObject.__init__(self)
+        self.bus = Gio.bus_get_sync(Gio.BusType.SESSION, None)
+
+    def call(self, path, interface, method, args=None, reply_type=None):
+        return self.bus.call_sync(BUS_NAME, path, interface, method, args,
+                                  reply_type, Gio.DBusCallFlags.NO_AUTO_START,
+                                  -1, None)
+
+    def list_devices(self):
+        """Returns connected paired devices as (object path, name) tuples."""
+        try:
+            reply = self.call(DAEMON_PATH, DAEMON_INTERFACE, 'ListDevices',
+                              None, GLib.VariantType('(ao)'))
+        except GLib.Error:
+            # GNOMEConnect isn't running
+            return []
+
+        devices = []
+        for path in reply.unpack()[0]:
+            try:
+                reply = self.call(path, PROPERTIES_INTERFACE, 'GetAll',
+                                  GLib.Variant('(s)', (DEVICE_INTERFACE,)),
+                                  GLib.VariantType('(a{sv})'))
+            except GLib.Error:
+                continue
+
+            props = reply.unpack()[0]
+            if props.get('Paired') and props.get('Reachable'):
+                devices.append((path, props.get('Name', path)))
+        return devices
+
+    def send_files(self, item, path, files):
+        for f in files:
+            try:
+                self.call(path, DEVICE_INTERFACE, 'SendFile',
+                          GLib.Variant('(s)', (f,)))
+            except GLib.Error as e:
+                print('Cannot send file:', e.message)
+
+    def get_file_items(self, *args):
+        # Older Nautilus versions pass the window as first argument
+        files = args[-1]
+
+        paths = [f.get_location().get_path() for f in files
+                 if f.get_uri_scheme() == 'file' and not f.is_directory()]
+        if not paths:
+            return []
+
+        devices = self.list_devices()
+        if not devices:
+            return []
+
+        menu_item = Nautilus.MenuItem(name='GnomeConnect::SendToDevice',
+                                      label='Send to device')
+        submenu = Nautilus.Menu()
+        menu_item.set_submenu(submenu)
+
+        for path, name in devices:
+            item = Nautilus.MenuItem(name='GnomeConnect::SendTo' + path,
+                                     label=name)
+            item.connect('activate', self.send_files, path, paths)
+            submenu.append_item(item)
+
+        return [menu_item]
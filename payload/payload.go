@@ -0,0 +1,222 @@
+// Package payload transfers KDE Connect package payloads.
+//
+// The sender opens a TCP server and advertises its port in the package. The
+// receiver connects to it, and the connection is secured with TLS, the sender
+// being the TLS server.
+package payload
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	minPort = 1739
+	maxPort = 1764
+)
+
+// The receiver must connect before this delay.
+const acceptTimeout = 30 * time.Second
+
+// The sender must accept the connection before this delay.
+const dialTimeout = 10 * time.Second
+
+// Transfers fail if no data is exchanged during this delay.
+const idleTimeout = 30 * time.Second
+
+var (
+	ErrNoPortAvailable = errors.New("No port available for payload transfer")
+	ErrNoCertificate   = errors.New("Peer didn't present a certificate")
+)
+
+// A Peer is the device at the other end of a transfer.
+type Peer struct {
+	// Address of the device. Connections from other hosts are rejected.
+	IP net.IP
+	// VerifyCertificate checks the certificate presented by the device.
+	VerifyCertificate func(cert *x509.Certificate) error
+}
+
+// verify checks the certificate presented on a TLS connection. The handshake
+// must be done.
+func (p *Peer) verify(conn *tls.Conn) error {
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return ErrNoCertificate
+	}
+	return p.VerifyCertificate(certs[0])
+}
+
+// NewConfig returns a TLS configuration for payload transfers. Certificates
+// are self-signed, so the standard verification is disabled: Send and
+// Receive check the peer's certificate with Peer.VerifyCertificate instead,
+// before any data is transferred.
+func NewConfig(cert tls.Certificate) *tls.Config {
+	return &tls.Config{
+		Certificates:       []tls.Certificate{cert},
+		InsecureSkipVerify: true,
+		ClientAuth:         tls.RequireAnyClientCert,
+	}
+}
+
+// A Transfer is a payload being sent.
+type Transfer struct {
+	Port int
+	Size int64
+
+	listener *net.TCPListener
+	config   *tls.Config
+	peer     *Peer
+	r        io.Reader
+	progress func(written int64)
+	done     chan struct{}
+	err      error
+}
+
+// Done returns a channel which is closed when the transfer is over.
+func (t *Transfer) Done() <-chan struct{} {
+	return t.done
+}
+
+// Err returns the error which stopped the transfer, if any. It must only be
+// called after the transfer is over.
+func (t *Transfer) Err() error {
+	return t.err
+}
+
+// accept waits for the peer to connect, and rejects other hosts.
+func (t *Transfer) accept() (net.Conn, error) {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+		if ok && addr.IP.Equal(t.peer.IP) {
+			return conn, nil
+		}
+
+		log.Println("Warning: rejecting payload connection from", conn.RemoteAddr())
+		conn.Close()
+	}
+}
+
+func (t *Transfer) serve() {
+	defer close(t.done)
+	defer t.listener.Close()
+
+	t.listener.SetDeadline(time.Now().Add(acceptTimeout))
+
+	rawConn, err := t.accept()
+	if err != nil {
+		t.err = err
+		return
+	}
+
+	conn := tls.Server(rawConn, t.config)
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(acceptTimeout))
+	if err := conn.Handshake(); err != nil {
+		t.err = err
+		return
+	}
+	if err := t.peer.verify(conn); err != nil {
+		t.err = err
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	w := &progressWriter{w: idleConn{conn}, progress: t.progress}
+	_, t.err = io.CopyN(w, t.r, t.Size)
+}
+
+// Send starts a server sending size bytes from r to peer. progress, if not
+// nil, is called with the number of bytes written so far.
+func Send(r io.Reader, size int64, config *tls.Config, peer *Peer, progress func(written int64)) (*Transfer, error) {
+	for port := minPort; port <= maxPort; port++ {
+		l, err := net.ListenTCP("tcp", &net.TCPAddr{Port: port})
+		if err != nil {
+			continue
+		}
+
+		t := &Transfer{
+			Port:     port,
+			Size:     size,
+			listener: l,
+			config:   config,
+			peer:     peer,
+			r:        r,
+			progress: progress,
+			done:     make(chan struct{}),
+		}
+
+		go t.serve()
+
+		return t, nil
+	}
+
+	return nil, ErrNoPortAvailable
+}
+
+// Receive connects to the payload server of peer and returns the payload.
+func Receive(peer *Peer, port int, size int64, config *tls.Config) (io.ReadCloser, error) {
+	addr := net.JoinHostPort(peer.IP.String(), strconv.Itoa(port))
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := peer.verify(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &readCloser{
+		Reader: io.LimitReader(idleConn{conn}, size),
+		Closer: conn,
+	}, nil
+}
+
+// idleConn is a connection whose reads and writes time out if no data is
+// exchanged during idleTimeout.
+type idleConn struct {
+	net.Conn
+}
+
+func (c idleConn) Read(b []byte) (int, error) {
+	c.SetReadDeadline(time.Now().Add(idleTimeout))
+	return c.Conn.Read(b)
+}
+
+func (c idleConn) Write(b []byte) (int, error) {
+	c.SetWriteDeadline(time.Now().Add(idleTimeout))
+	return c.Conn.Write(b)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type progressWriter struct {
+	w        io.Writer
+	written  int64
+	progress func(written int64)
+}
+
+func (w *progressWriter) Write(b []byte) (n int, err error) {
+	n, err = w.w.Write(b)
+	w.written += int64(n)
+	if w.progress != nil {
+		w.progress(w.written)
+	}
+	return
+}
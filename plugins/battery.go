@@ -0,0 +1,17 @@
+package plugins
+
+import (
+	"github.com/emersion/go-kdeconnect/network"
+	"github.com/emersion/go-kdeconnect/protocol"
+)
+
+const BatteryRequestType protocol.PackageType = "kdeconnect.battery.request"
+
+type BatteryRequestBody struct {
+	Request bool `json:"request"`
+}
+
+// SendBatteryRequest asks a device to send its battery state.
+func SendBatteryRequest(device *network.Device) error {
+	return device.Send(BatteryRequestType, &BatteryRequestBody{Request: true})
+}
@@ -0,0 +1,76 @@
+package plugins
+
+import (
+	"encoding/json"
+	"github.com/emersion/go-kdeconnect/network"
+	"github.com/emersion/go-kdeconnect/protocol"
+	"log"
+	"time"
+)
+
+const (
+	ClipboardType protocol.PackageType = "kdeconnect.clipboard"
+	// Sent when connecting, with the current clipboard and the time it was
+	// last changed
+	ClipboardConnectType protocol.PackageType = "kdeconnect.clipboard.connect"
+)
+
+type ClipboardBody struct {
+	Content string `json:"content"`
+	// Time of the last change, in milliseconds since the epoch. Only set in
+	// connect packages.
+	Timestamp int64 `json:"timestamp,omitempty"`
+}
+
+type ClipboardEvent struct {
+	Event
+	ClipboardBody
+	// True if the content has been sent when the device connected, instead
+	// of on change
+	Connect bool
+}
+
+// Clipboard synchronizes the clipboard with devices.
+type Clipboard struct {
+	Incoming chan *ClipboardEvent
+}
+
+func (p *Clipboard) Handle(device *network.Device, pkg *protocol.Package) bool {
+	if pkg.Type != ClipboardType && pkg.Type != ClipboardConnectType {
+		return false
+	}
+
+	body := ClipboardBody{}
+	if err := json.Unmarshal(pkg.Body, &body); err != nil {
+		log.Println("Cannot decode clipboard content:", err)
+		return true
+	}
+
+	p.Incoming <- &ClipboardEvent{
+		Event:         Event{Device: device},
+		ClipboardBody: body,
+		Connect:       pkg.Type == ClipboardConnectType,
+	}
+	return true
+}
+
+// SendClipboard sends the content of the clipboard to a device.
+func (p *Clipboard) SendClipboard(device *network.Device, content string) error {
+	return device.Send(ClipboardType, &ClipboardBody{Content: content})
+}
+
+// SendClipboardConnect sends the content of the clipboard to a device which
+// has just connected. The device only applies it if it's more recent than its
+// own clipboard.
+func (p *Clipboard) SendClipboardConnect(device *network.Device, content string, updated time.Time) error {
+	return device.Send(ClipboardConnectType, &ClipboardBody{
+		Content:   content,
+		Timestamp: updated.UnixNano() / int64(time.Millisecond),
+	})
+}
+
+func NewClipboard() *Clipboard {
+	return &Clipboard{
+		Incoming: make(chan *ClipboardEvent),
+	}
+}
@@ -0,0 +1,39 @@
+package plugins
+
+import (
+	"github.com/emersion/go-kdeconnect/network"
+	"github.com/emersion/go-kdeconnect/protocol"
+)
+
+const FindMyPhoneRequestType protocol.PackageType = "kdeconnect.findmyphone.request"
+
+type FindMyPhoneEvent struct {
+	Event
+}
+
+// FindMyPhone receives requests from devices asking the desktop to ring.
+type FindMyPhone struct {
+	Incoming chan *FindMyPhoneEvent
+}
+
+func (p *FindMyPhone) Handle(device *network.Device, pkg *protocol.Package) bool {
+	if pkg.Type != FindMyPhoneRequestType {
+		return false
+	}
+
+	p.Incoming <- &FindMyPhoneEvent{
+		Event: Event{Device: device},
+	}
+	return true
+}
+
+// SendFindMyPhoneRequest makes a device ring, so that it can be found.
+func SendFindMyPhoneRequest(device *network.Device) error {
+	return device.Send(FindMyPhoneRequestType, struct{}{})
+}
+
+func NewFindMyPhone() *FindMyPhone {
+	return &FindMyPhone{
+		Incoming: make(chan *FindMyPhoneEvent),
+	}
+}
@@ -0,0 +1,133 @@
+package plugins
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"github.com/emersion/go-kdeconnect/network"
+	"github.com/emersion/go-kdeconnect/protocol"
+	"io"
+	"log"
+)
+
+const (
+	MprisType        protocol.PackageType = "kdeconnect.mpris"
+	MprisRequestType protocol.PackageType = "kdeconnect.mpris.request"
+)
+
+// MprisBody is sent to devices to describe a player.
+type MprisBody struct {
+	PlayerList []string `json:"playerList,omitempty"`
+	Player     string   `json:"player,omitempty"`
+
+	NowPlaying  string `json:"nowPlaying,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Artist      string `json:"artist,omitempty"`
+	Album       string `json:"album,omitempty"`
+	AlbumArtUrl string `json:"albumArtUrl,omitempty"`
+
+	IsPlaying bool `json:"isPlaying"`
+	// In milliseconds
+	Length int64 `json:"length"`
+	Pos    int64 `json:"pos"`
+	Volume int   `json:"volume"`
+
+	Shuffle    bool   `json:"shuffle"`
+	LoopStatus string `json:"loopStatus,omitempty"`
+
+	CanPause      bool `json:"canPause"`
+	CanPlay       bool `json:"canPlay"`
+	CanGoNext     bool `json:"canGoNext"`
+	CanGoPrevious bool `json:"canGoPrevious"`
+	CanSeek       bool `json:"canSeek"`
+
+	TransferringAlbumArt bool `json:"transferringAlbumArt,omitempty"`
+}
+
+// MprisRequestBody is sent by devices to control a player.
+type MprisRequestBody struct {
+	RequestPlayerList bool   `json:"requestPlayerList,omitempty"`
+	Player            string `json:"player,omitempty"`
+	RequestNowPlaying bool   `json:"requestNowPlaying,omitempty"`
+	RequestVolume     bool   `json:"requestVolume,omitempty"`
+	Action            string `json:"action,omitempty"`
+	SetVolume         *int   `json:"setVolume,omitempty"`
+	SetShuffle        *bool  `json:"setShuffle,omitempty"`
+	SetLoopStatus     string `json:"setLoopStatus,omitempty"`
+	// Relative offset, in microseconds
+	Seek int64 `json:"Seek,omitempty"`
+	// Absolute position, in milliseconds
+	SetPosition *int64 `json:"SetPosition,omitempty"`
+	// Album art URL requested by the device
+	AlbumArtUrl string `json:"albumArtUrl,omitempty"`
+}
+
+type MprisEvent struct {
+	Event
+	MprisRequestBody
+}
+
+type Mpris struct {
+	Incoming chan *MprisEvent
+
+	tlsConfig *tls.Config
+}
+
+func (p *Mpris) Handle(device *network.Device, pkg *protocol.Package) bool {
+	// Older versions of the Android app use MprisType for requests
+	if pkg.Type != MprisRequestType && pkg.Type != MprisType {
+		return false
+	}
+
+	body := MprisRequestBody{}
+	if err := json.Unmarshal(pkg.Body, &body); err != nil {
+		log.Println("Cannot decode MPRIS request:", err)
+		return true
+	}
+
+	p.Incoming <- &MprisEvent{
+		Event:            Event{Device: device},
+		MprisRequestBody: body,
+	}
+	return true
+}
+
+func (p *Mpris) SendPlayerList(device *network.Device, players []string) error {
+	return device.Send(MprisType, &MprisBody{PlayerList: players})
+}
+
+func (p *Mpris) SendPlayer(device *network.Device, body *MprisBody) error {
+	return device.Send(MprisType, body)
+}
+
+// SendAlbumArt transfers the album art of a player to a device. state is the
+// current state of the player, it is sent along with the album art since
+// devices replace their state with it. The transfer happens in the
+// background, r is closed when it's done.
+func (p *Mpris) SendAlbumArt(device *network.Device, state *MprisBody, r io.ReadCloser, size int64) error {
+	transfer, err := sendPayload(device, r, size, p.tlsConfig, nil)
+	if err != nil {
+		r.Close()
+		return err
+	}
+
+	go func() {
+		<-transfer.Done()
+		if err := transfer.Err(); err != nil {
+			log.Println("Cannot transfer album art:", err)
+		}
+		r.Close()
+	}()
+
+	body := *state
+	body.TransferringAlbumArt = true
+	return sendWithPayload(device, MprisType, &body, transfer)
+}
+
+// NewMpris creates a new MPRIS plugin. tlsConfig is used to transfer album
+// arts.
+func NewMpris(tlsConfig *tls.Config) *Mpris {
+	return &Mpris{
+		Incoming:  make(chan *MprisEvent),
+		tlsConfig: tlsConfig,
+	}
+}
@@ -0,0 +1,96 @@
+package plugins
+
+import (
+	"encoding/json"
+	"github.com/emersion/go-kdeconnect/network"
+	"github.com/emersion/go-kdeconnect/protocol"
+	"log"
+)
+
+const (
+	NotificationType        protocol.PackageType = "kdeconnect.notification"
+	NotificationRequestType protocol.PackageType = "kdeconnect.notification.request"
+	NotificationActionType  protocol.PackageType = "kdeconnect.notification.action"
+	NotificationReplyType   protocol.PackageType = "kdeconnect.notification.reply"
+)
+
+type NotificationBody struct {
+	Id             string   `json:"id"`
+	AppName        string   `json:"appName,omitempty"`
+	Ticker         string   `json:"ticker,omitempty"`
+	Title          string   `json:"title,omitempty"`
+	Text           string   `json:"text,omitempty"`
+	IsClearable    bool     `json:"isClearable,omitempty"`
+	IsCancel       bool     `json:"isCancel,omitempty"`
+	Actions        []string `json:"actions,omitempty"`
+	RequestReplyId string   `json:"requestReplyId,omitempty"`
+}
+
+type NotificationRequestBody struct {
+	Request bool   `json:"request,omitempty"`
+	Cancel  string `json:"cancel,omitempty"`
+}
+
+type NotificationActionBody struct {
+	Key    string `json:"key"`
+	Action string `json:"action"`
+}
+
+type NotificationReplyBody struct {
+	RequestReplyId string `json:"requestReplyId"`
+	Message        string `json:"message"`
+}
+
+type NotificationEvent struct {
+	Event
+	NotificationBody
+}
+
+type Notification struct {
+	Incoming chan *NotificationEvent
+}
+
+func (p *Notification) Handle(device *network.Device, pkg *protocol.Package) bool {
+	if pkg.Type != NotificationType {
+		return false
+	}
+
+	body := NotificationBody{}
+	if err := json.Unmarshal(pkg.Body, &body); err != nil {
+		log.Println("Cannot decode notification:", err)
+		return true
+	}
+
+	p.Incoming <- &NotificationEvent{
+		Event:            Event{Device: device},
+		NotificationBody: body,
+	}
+	return true
+}
+
+// SendCancel asks the device to dismiss a notification.
+func (p *Notification) SendCancel(device *network.Device, id string) error {
+	return device.Send(NotificationRequestType, &NotificationRequestBody{Cancel: id})
+}
+
+// SendAction triggers one of the actions of a notification on the device.
+func (p *Notification) SendAction(device *network.Device, id, action string) error {
+	return device.Send(NotificationActionType, &NotificationActionBody{
+		Key:    id,
+		Action: action,
+	})
+}
+
+// SendReply answers a notification which supports quick replies.
+func (p *Notification) SendReply(device *network.Device, requestReplyId, message string) error {
+	return device.Send(NotificationReplyType, &NotificationReplyBody{
+		RequestReplyId: requestReplyId,
+		Message:        message,
+	})
+}
+
+func NewNotification() *Notification {
+	return &Notification{
+		Incoming: make(chan *NotificationEvent),
+	}
+}
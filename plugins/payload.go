@@ -0,0 +1,72 @@
+package plugins
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"github.com/emersion/gnomeconnect/payload"
+	"github.com/emersion/gnomeconnect/utils"
+	"github.com/emersion/go-kdeconnect/network"
+	"github.com/emersion/go-kdeconnect/protocol"
+	"io"
+	"net"
+)
+
+// sendWithPayload sends a package announcing a payload transfer.
+func sendWithPayload(device *network.Device, t protocol.PackageType, body interface{}, transfer *payload.Transfer) error {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	return device.SendPackage(&protocol.Package{
+		Type:        t,
+		Body:        raw,
+		PayloadSize: transfer.Size,
+		PayloadTransferInfo: &protocol.PayloadTransferInfo{
+			Port: transfer.Port,
+		},
+	})
+}
+
+// devicePeer returns the payload peer of a device. Only the device's address
+// can connect, and it must present a certificate matching its public key.
+func devicePeer(device *network.Device) (*payload.Peer, error) {
+	host, _, err := net.SplitHostPort(device.Addr().String())
+	if err != nil {
+		return nil, err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, errors.New("Invalid device address: " + host)
+	}
+
+	return &payload.Peer{
+		IP: ip,
+		VerifyCertificate: func(cert *x509.Certificate) error {
+			return utils.VerifyDeviceCertificate(device, cert)
+		},
+	}, nil
+}
+
+// sendPayload starts a payload transfer to a device.
+func sendPayload(device *network.Device, r io.Reader, size int64, tlsConfig *tls.Config, progress func(written int64)) (*payload.Transfer, error) {
+	peer, err := devicePeer(device)
+	if err != nil {
+		return nil, err
+	}
+
+	return payload.Send(r, size, tlsConfig, peer, progress)
+}
+
+// receivePayload opens the payload announced by a device on port.
+func receivePayload(device *network.Device, port int, size int64, tlsConfig *tls.Config) (io.ReadCloser, error) {
+	peer, err := devicePeer(device)
+	if err != nil {
+		return nil, err
+	}
+
+	return payload.Receive(peer, port, size, tlsConfig)
+}
@@ -0,0 +1,11 @@
+// Package plugins implements KDE Connect plugins which are missing from
+// go-kdeconnect or which need more fields than the upstream ones decode.
+package plugins
+
+import (
+	"github.com/emersion/go-kdeconnect/network"
+)
+
+type Event struct {
+	Device *network.Device
+}
@@ -0,0 +1,73 @@
+package plugins
+
+import (
+	"encoding/json"
+	"github.com/emersion/go-kdeconnect/network"
+	"github.com/emersion/go-kdeconnect/protocol"
+	"log"
+)
+
+const (
+	RunCommandType        protocol.PackageType = "kdeconnect.runcommand"
+	RunCommandRequestType protocol.PackageType = "kdeconnect.runcommand.request"
+)
+
+// Command is a shell command which can be run by a device.
+type Command struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+}
+
+type RunCommandBody struct {
+	// JSON-encoded map of command keys to commands
+	CommandList string `json:"commandList"`
+}
+
+type RunCommandRequestBody struct {
+	Key                string `json:"key,omitempty"`
+	RequestCommandList bool   `json:"requestCommandList,omitempty"`
+}
+
+type RunCommandEvent struct {
+	Event
+	RunCommandRequestBody
+}
+
+// RunCommand lets devices run commands on the desktop.
+type RunCommand struct {
+	Incoming chan *RunCommandEvent
+}
+
+func (p *RunCommand) Handle(device *network.Device, pkg *protocol.Package) bool {
+	if pkg.Type != RunCommandRequestType {
+		return false
+	}
+
+	body := RunCommandRequestBody{}
+	if err := json.Unmarshal(pkg.Body, &body); err != nil {
+		log.Println("Cannot decode run command request:", err)
+		return true
+	}
+
+	p.Incoming <- &RunCommandEvent{
+		Event:                 Event{Device: device},
+		RunCommandRequestBody: body,
+	}
+	return true
+}
+
+// SendCommandList advertises the commands a device can run.
+func (p *RunCommand) SendCommandList(device *network.Device, commands map[string]*Command) error {
+	raw, err := json.Marshal(commands)
+	if err != nil {
+		return err
+	}
+
+	return device.Send(RunCommandType, &RunCommandBody{CommandList: string(raw)})
+}
+
+func NewRunCommand() *RunCommand {
+	return &RunCommand{
+		Incoming: make(chan *RunCommandEvent),
+	}
+}
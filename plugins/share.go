@@ -0,0 +1,118 @@
+package plugins
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"github.com/emersion/gnomeconnect/payload"
+	"github.com/emersion/go-kdeconnect/network"
+	"github.com/emersion/go-kdeconnect/protocol"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+const ShareType protocol.PackageType = "kdeconnect.share.request"
+
+var ErrNoPayload = errors.New("Package has no payload")
+
+type ShareBody struct {
+	Filename string `json:"filename,omitempty"`
+	Url      string `json:"url,omitempty"`
+	Text     string `json:"text,omitempty"`
+}
+
+type ShareEvent struct {
+	Event
+	ShareBody
+
+	PayloadSize int64
+	// Port of the payload server, zero if there is no payload
+	PayloadPort int
+}
+
+// Share sends and receives files, URLs and text.
+type Share struct {
+	Incoming chan *ShareEvent
+
+	tlsConfig *tls.Config
+}
+
+func (p *Share) Handle(device *network.Device, pkg *protocol.Package) bool {
+	if pkg.Type != ShareType {
+		return false
+	}
+
+	body := ShareBody{}
+	if err := json.Unmarshal(pkg.Body, &body); err != nil {
+		log.Println("Cannot decode share request:", err)
+		return true
+	}
+
+	event := &ShareEvent{
+		Event:       Event{Device: device},
+		ShareBody:   body,
+		PayloadSize: pkg.PayloadSize,
+	}
+	if pkg.PayloadTransferInfo != nil {
+		event.PayloadPort = pkg.PayloadTransferInfo.Port
+	}
+
+	p.Incoming <- event
+	return true
+}
+
+// SendFile sends a file to a device. The transfer happens in the background.
+// progress, if not nil, is called with the number of bytes sent so far.
+func (p *Share) SendFile(device *network.Device, path string, progress func(written int64)) (*payload.Transfer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	transfer, err := sendPayload(device, f, info.Size(), p.tlsConfig, progress)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	err = sendWithPayload(device, ShareType, &ShareBody{
+		Filename: filepath.Base(path),
+	}, transfer)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	go func() {
+		// Wait for the transfer to finish before closing the file
+		<-transfer.Done()
+		f.Close()
+	}()
+
+	return transfer, nil
+}
+
+// Receive opens the payload of a shared file.
+func (p *Share) Receive(event *ShareEvent) (io.ReadCloser, error) {
+	if event.PayloadPort == 0 {
+		return nil, ErrNoPayload
+	}
+
+	return receivePayload(event.Device, event.PayloadPort, event.PayloadSize, p.tlsConfig)
+}
+
+// NewShare creates a new share plugin. tlsConfig is used for file transfers.
+func NewShare(tlsConfig *tls.Config) *Share {
+	return &Share{
+		Incoming:  make(chan *ShareEvent),
+		tlsConfig: tlsConfig,
+	}
+}
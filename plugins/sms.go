@@ -0,0 +1,97 @@
+package plugins
+
+import (
+	"encoding/json"
+	"github.com/emersion/go-kdeconnect/network"
+	"github.com/emersion/go-kdeconnect/protocol"
+	"log"
+)
+
+const (
+	SmsMessagesType             protocol.PackageType = "kdeconnect.sms.messages"
+	SmsRequestConversationsType protocol.PackageType = "kdeconnect.sms.request_conversations"
+	SmsRequestConversationType  protocol.PackageType = "kdeconnect.sms.request_conversation"
+)
+
+const (
+	SmsMessageTypeInbox = 1
+	SmsMessageTypeSent  = 2
+)
+
+type SmsAddress struct {
+	Address string `json:"address"`
+}
+
+type SmsMessage struct {
+	Id       int64  `json:"_id"`
+	ThreadId int64  `json:"thread_id"`
+	Body     string `json:"body"`
+	// Milliseconds since the UNIX epoch
+	Date int64 `json:"date"`
+	Type int   `json:"type"`
+	Read int   `json:"read"`
+	// Older versions of the Android app only send a single address
+	Address   string        `json:"address,omitempty"`
+	Addresses []*SmsAddress `json:"addresses,omitempty"`
+}
+
+// GetAddress returns the phone number of the message's correspondent.
+func (m *SmsMessage) GetAddress() string {
+	if len(m.Addresses) > 0 {
+		return m.Addresses[0].Address
+	}
+	return m.Address
+}
+
+type SmsMessagesBody struct {
+	Messages []*SmsMessage `json:"messages"`
+}
+
+type SmsRequestConversationBody struct {
+	ThreadId int64 `json:"threadID"`
+}
+
+type SmsMessagesEvent struct {
+	Event
+	SmsMessagesBody
+}
+
+// Sms synchronizes SMS conversations with devices.
+type Sms struct {
+	Incoming chan *SmsMessagesEvent
+}
+
+func (p *Sms) Handle(device *network.Device, pkg *protocol.Package) bool {
+	if pkg.Type != SmsMessagesType {
+		return false
+	}
+
+	body := SmsMessagesBody{}
+	if err := json.Unmarshal(pkg.Body, &body); err != nil {
+		log.Println("Cannot decode SMS messages:", err)
+		return true
+	}
+
+	p.Incoming <- &SmsMessagesEvent{
+		Event:           Event{Device: device},
+		SmsMessagesBody: body,
+	}
+	return true
+}
+
+// SendRequestConversations asks a device for the latest message of each
+// conversation.
+func (p *Sms) SendRequestConversations(device *network.Device) error {
+	return device.Send(SmsRequestConversationsType, struct{}{})
+}
+
+// SendRequestConversation asks a device for all messages of a conversation.
+func (p *Sms) SendRequestConversation(device *network.Device, threadId int64) error {
+	return device.Send(SmsRequestConversationType, &SmsRequestConversationBody{ThreadId: threadId})
+}
+
+func NewSms() *Sms {
+	return &Sms{
+		Incoming: make(chan *SmsMessagesEvent),
+	}
+}
@@ -0,0 +1,40 @@
+package plugins
+
+import (
+	"github.com/emersion/go-kdeconnect/network"
+	"github.com/emersion/go-kdeconnect/protocol"
+)
+
+const TelephonyRequestType protocol.PackageType = "kdeconnect.telephony.request"
+
+const (
+	TelephonyActionMute   = "mute"
+	TelephonyActionReject = "reject"
+)
+
+type TelephonyRequestBody struct {
+	Action string `json:"action,omitempty"`
+}
+
+// SendTelephonyAction asks a device to perform an action on the current call,
+// e.g. TelephonyActionMute.
+func SendTelephonyAction(device *network.Device, action string) error {
+	return device.Send(TelephonyRequestType, &TelephonyRequestBody{Action: action})
+}
+
+const SmsRequestType protocol.PackageType = "kdeconnect.sms.request"
+
+type SmsRequestBody struct {
+	SendSms     bool   `json:"sendSms"`
+	PhoneNumber string `json:"phoneNumber"`
+	MessageBody string `json:"messageBody"`
+}
+
+// SendSms asks a device to send an SMS.
+func SendSms(device *network.Device, phoneNumber, message string) error {
+	return device.Send(SmsRequestType, &SmsRequestBody{
+		SendSms:     true,
+		PhoneNumber: phoneNumber,
+		MessageBody: message,
+	})
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"github.com/emersion/gnomeconnect/conversations"
+	"github.com/emersion/gnomeconnect/handlers"
+	"github.com/emersion/gnomeconnect/plugins"
+	"github.com/emersion/go-kdeconnect/network"
+	"github.com/godbus/dbus"
+	"github.com/godbus/dbus/introspect"
+	"github.com/godbus/dbus/prop"
+	"log"
+	"time"
+)
+
+// deviceObject is the D-Bus object of a device. Its fields are protected by
+// the service's lock.
+type deviceObject struct {
+	service   *Service
+	device    *network.Device
+	path      dbus.ObjectPath
+	props     *prop.Properties
+	reachable bool
+}
+
+func (d *deviceObject) export() error {
+	conn := d.service.conn
+
+	if err := conn.Export(d, d.path, DeviceInterface); err != nil {
+		return err
+	}
+	err := conn.Export(introspect.Introspectable(deviceIntrospection), d.path, "org.freedesktop.DBus.Introspectable")
+	if err != nil {
+		return err
+	}
+
+	battery, charging := int32(-1), false
+	if d.service.plugins.Battery != nil {
+		if state, ok := d.service.plugins.Battery.State(d.device.Id); ok {
+			battery, charging = int32(state.Charge), state.IsCharging
+		}
+	}
+
+	d.props = prop.New(conn, d.path, map[string]map[string]*prop.Prop{
+		DeviceInterface: {
+			"Id":        {Value: d.device.Id, Emit: prop.EmitFalse},
+			"Name":      {Value: d.device.Name, Emit: prop.EmitTrue},
+			"Type":      {Value: d.device.Type, Emit: prop.EmitTrue},
+			"Paired":    {Value: d.device.Paired, Emit: prop.EmitTrue},
+			"Reachable": {Value: d.reachable, Emit: prop.EmitTrue},
+			"Battery":   {Value: battery, Emit: prop.EmitTrue},
+			"Charging":  {Value: charging, Emit: prop.EmitTrue},
+		},
+	})
+
+	return nil
+}
+
+func (d *deviceObject) unexport() {
+	conn := d.service.conn
+	conn.Export(nil, d.path, DeviceInterface)
+	conn.Export(nil, d.path, "org.freedesktop.DBus.Introspectable")
+	conn.Export(nil, d.path, "org.freedesktop.DBus.Properties")
+}
+
+func (d *deviceObject) update(device *network.Device, reachable bool) {
+	d.device = device
+	d.reachable = reachable
+
+	d.props.Set(DeviceInterface, "Name", dbus.MakeVariant(device.Name))
+	d.props.Set(DeviceInterface, "Type", dbus.MakeVariant(device.Type))
+	d.props.Set(DeviceInterface, "Paired", dbus.MakeVariant(device.Paired))
+	d.props.Set(DeviceInterface, "Reachable", dbus.MakeVariant(reachable))
+}
+
+func (d *deviceObject) updateBattery(state handlers.BatteryState) {
+	d.props.Set(DeviceInterface, "Battery", dbus.MakeVariant(int32(state.Charge)))
+	d.props.Set(DeviceInterface, "Charging", dbus.MakeVariant(state.IsCharging))
+}
+
+// reachableDevice returns the device if it can be used, or a D-Bus error.
+func (d *deviceObject) reachableDevice(mustBePaired bool) (*network.Device, *dbus.Error) {
+	d.service.locker.Lock()
+	defer d.service.locker.Unlock()
+
+	if !d.reachable {
+		return nil, dbus.NewError(errorNotReachable, []interface{}{"Device is not reachable"})
+	}
+	if mustBePaired && !d.device.Paired {
+		return nil, dbus.NewError(errorNotPaired, []interface{}{"Device is not paired"})
+	}
+	return d.device, nil
+}
+
+func failed(err error) *dbus.Error {
+	if err == nil {
+		return nil
+	}
+	return dbus.NewError(errorFailed, []interface{}{err.Error()})
+}
+
+func (d *deviceObject) Pair() *dbus.Error {
+	device, derr := d.reachableDevice(false)
+	if derr != nil {
+		return derr
+	}
+
+	return failed(d.service.engine.PairDevice(device))
+}
+
+func (d *deviceObject) Unpair() *dbus.Error {
+	device, derr := d.reachableDevice(false)
+	if derr != nil {
+		return derr
+	}
+
+	return failed(d.service.engine.UnpairDevice(device))
+}
+
+func (d *deviceObject) Ping() *dbus.Error {
+	device, derr := d.reachableDevice(true)
+	if derr != nil {
+		return derr
+	}
+
+	d.service.plugins.Ping.SendPing(device)
+	return nil
+}
+
+func (d *deviceObject) Ring() *dbus.Error {
+	device, derr := d.reachableDevice(true)
+	if derr != nil {
+		return derr
+	}
+
+	return failed(plugins.SendFindMyPhoneRequest(device))
+}
+
+func (d *deviceObject) Browse() *dbus.Error {
+	device, derr := d.reachableDevice(true)
+	if derr != nil {
+		return derr
+	}
+
+	d.service.plugins.Sftp.SendStartBrowsing(device)
+	return nil
+}
+
+func (d *deviceObject) SendFile(path string) *dbus.Error {
+	device, derr := d.reachableDevice(true)
+	if derr != nil {
+		return derr
+	}
+
+	return failed(d.service.plugins.Share.SendFile(device, path))
+}
+
+func (d *deviceObject) SendSms(number, message string) *dbus.Error {
+	device, derr := d.reachableDevice(true)
+	if derr != nil {
+		return derr
+	}
+
+	if err := plugins.SendSms(device, number, message); err != nil {
+		return failed(err)
+	}
+
+	if store := d.service.plugins.Store; store != nil {
+		err := store.Add(device.Id, &conversations.Message{
+			Address: number,
+			Body:    message,
+			Date:    time.Now(),
+			Sent:    true,
+		})
+		if err != nil {
+			log.Println("Cannot save SMS:", err)
+		}
+	}
+
+	return nil
+}
+
+func newDeviceObject(s *Service, device *network.Device) *deviceObject {
+	return &deviceObject{
+		service:   s,
+		device:    device,
+		path:      devicePath(device.Id),
+		reachable: true,
+	}
+}
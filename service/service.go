@@ -0,0 +1,264 @@
+// Package service exposes GNOMEConnect on the session bus, so that other
+// applications can list and control devices.
+package service
+
+import (
+	"errors"
+	"github.com/emersion/gnomeconnect/conversations"
+	"github.com/emersion/gnomeconnect/handlers"
+	"github.com/emersion/go-kdeconnect/engine"
+	"github.com/emersion/go-kdeconnect/network"
+	"github.com/emersion/go-kdeconnect/plugin"
+	"github.com/godbus/dbus"
+	"github.com/godbus/dbus/introspect"
+	"github.com/godbus/dbus/prop"
+	"sort"
+	"sync"
+)
+
+const (
+	Name            = "org.gnomeconnect.Daemon"
+	Path            = "/org/gnomeconnect/Daemon"
+	DaemonInterface = "org.gnomeconnect.Daemon"
+	DeviceInterface = "org.gnomeconnect.Device"
+
+	devicesPath = Path + "/devices/"
+)
+
+const (
+	errorNotReachable = "org.gnomeconnect.Error.NotReachable"
+	errorNotPaired    = "org.gnomeconnect.Error.NotPaired"
+	errorFailed       = "org.gnomeconnect.Error.Failed"
+	errorNoSuchDevice = "org.gnomeconnect.Error.NoSuchDevice"
+)
+
+var ErrNameTaken = errors.New("D-Bus name is already taken")
+
+const daemonIntrospection = `<node>
+	<interface name="` + DaemonInterface + `">
+		<method name="ListDevices">
+			<arg name="devices" type="ao" direction="out"/>
+		</method>
+		<method name="Activate">
+			<arg name="args" type="as" direction="in"/>
+		</method>
+		<signal name="DeviceAdded">
+			<arg name="device" type="o"/>
+		</signal>
+		<signal name="DeviceRemoved">
+			<arg name="device" type="o"/>
+		</signal>
+		<signal name="DeviceConnected">
+			<arg name="device" type="o"/>
+		</signal>
+		<signal name="DeviceDisconnected">
+			<arg name="device" type="o"/>
+		</signal>
+	</interface>` + introspect.IntrospectDataString + `</node>`
+
+const deviceIntrospection = `<node>
+	<interface name="` + DeviceInterface + `">
+		<property name="Id" type="s" access="read"/>
+		<property name="Name" type="s" access="read"/>
+		<property name="Type" type="s" access="read"/>
+		<property name="Paired" type="b" access="read"/>
+		<property name="Reachable" type="b" access="read"/>
+		<property name="Battery" type="i" access="read"/>
+		<property name="Charging" type="b" access="read"/>
+		<method name="Pair"/>
+		<method name="Unpair"/>
+		<method name="Ping"/>
+		<method name="Ring"/>
+		<method name="Browse"/>
+		<method name="SendFile">
+			<arg name="path" type="s" direction="in"/>
+		</method>
+		<method name="SendSms">
+			<arg name="number" type="s" direction="in"/>
+			<arg name="message" type="s" direction="in"/>
+		</method>
+	</interface>` + prop.IntrospectDataString + introspect.IntrospectDataString + `</node>`
+
+// Plugins contains the plugins and handlers used by the service.
+type Plugins struct {
+	Ping    *plugin.Ping
+	Sftp    *plugin.Sftp
+	Battery *handlers.Battery
+	Store   *conversations.Store
+	Share   *handlers.Share
+}
+
+type Service struct {
+	conn    *dbus.Conn
+	engine  *engine.Engine
+	plugins *Plugins
+
+	locker  sync.Mutex
+	devices map[string]*deviceObject
+
+	// Receives the command-line arguments of other instances
+	Activated chan []string
+}
+
+// devicePath returns the object path of a device. Device IDs can contain
+// characters which are not allowed in object paths.
+func devicePath(id string) dbus.ObjectPath {
+	b := []byte(id)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	return dbus.ObjectPath(devicesPath + string(b))
+}
+
+func (s *Service) ListDevices() ([]dbus.ObjectPath, *dbus.Error) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	paths := make([]string, 0, len(s.devices))
+	for _, d := range s.devices {
+		paths = append(paths, string(d.path))
+	}
+	sort.Strings(paths)
+
+	l := make([]dbus.ObjectPath, len(paths))
+	for i, p := range paths {
+		l[i] = dbus.ObjectPath(p)
+	}
+	return l, nil
+}
+
+// Activate is called by other instances with their command-line arguments,
+// instead of starting.
+func (s *Service) Activate(args []string) *dbus.Error {
+	go func() {
+		s.Activated <- args
+	}()
+	return nil
+}
+
+// DeviceJoined exports a device which has become reachable. DeviceAdded is
+// only emitted the first time a device is seen, DeviceConnected each time it
+// joins.
+func (s *Service) DeviceJoined(device *network.Device) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	d, ok := s.devices[device.Id]
+	if ok {
+		wasReachable := d.reachable
+		d.update(device, true)
+		if wasReachable {
+			return
+		}
+	} else {
+		d = newDeviceObject(s, device)
+		if err := d.export(); err != nil {
+			return
+		}
+		s.devices[device.Id] = d
+
+		s.conn.Emit(Path, DaemonInterface+".DeviceAdded", d.path)
+	}
+
+	s.conn.Emit(Path, DaemonInterface+".DeviceConnected", d.path)
+}
+
+// DeviceChanged updates a device's properties, e.g. after pairing.
+func (s *Service) DeviceChanged(device *network.Device) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if d, ok := s.devices[device.Id]; ok {
+		d.update(device, d.reachable)
+	}
+}
+
+// DeviceLeft marks a device as unreachable. Unpaired devices are removed.
+func (s *Service) DeviceLeft(device *network.Device) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	d, ok := s.devices[device.Id]
+	if !ok {
+		return
+	}
+
+	if d.reachable {
+		s.conn.Emit(Path, DaemonInterface+".DeviceDisconnected", d.path)
+	}
+
+	if device.Paired {
+		d.update(device, false)
+		return
+	}
+
+	d.unexport()
+	delete(s.devices, device.Id)
+
+	s.conn.Emit(Path, DaemonInterface+".DeviceRemoved", d.path)
+}
+
+// watchBattery keeps the battery properties of devices up to date.
+func (s *Service) watchBattery() {
+	for update := range s.plugins.Battery.Subscribe() {
+		s.locker.Lock()
+		if d, ok := s.devices[update.Device.Id]; ok {
+			d.updateBattery(update.BatteryState)
+		}
+		s.locker.Unlock()
+	}
+}
+
+// Activate passes command-line arguments to the running instance. ok is false
+// if there is no running instance.
+func Activate(conn *dbus.Conn, args []string) (ok bool, err error) {
+	if args == nil {
+		args = []string{}
+	}
+
+	call := conn.Object(Name, Path).Call(DaemonInterface+".Activate", 0, args)
+	if dbusErr, isDbusErr := call.Err.(dbus.Error); isDbusErr && dbusErr.Name == "org.freedesktop.DBus.Error.ServiceUnknown" {
+		return false, nil
+	} else if call.Err != nil {
+		return false, call.Err
+	}
+	return true, nil
+}
+
+// New exports the service on the session bus. ErrNameTaken is returned if
+// another instance already owns the service name. The name is released by the
+// bus when the process exits, even if it crashes.
+func New(conn *dbus.Conn, e *engine.Engine, plugins *Plugins) (*Service, error) {
+	s := &Service{
+		conn:    conn,
+		engine:  e,
+		plugins: plugins,
+		devices: map[string]*deviceObject{},
+
+		Activated: make(chan []string),
+	}
+
+	if err := conn.Export(s, Path, DaemonInterface); err != nil {
+		return nil, err
+	}
+	err := conn.Export(introspect.Introspectable(daemonIntrospection), Path, "org.freedesktop.DBus.Introspectable")
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.RequestName(Name, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return nil, err
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return nil, ErrNameTaken
+	}
+
+	if plugins.Battery != nil {
+		go s.watchBattery()
+	}
+
+	return s, nil
+}
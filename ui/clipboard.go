@@ -0,0 +1,44 @@
+package ui
+
+import (
+	"github.com/conformal/gotk3/gdk"
+	"github.com/conformal/gotk3/gtk"
+	"log"
+)
+
+// SetClipboardText replaces the content of the clipboard with text. It can be
+// called from any goroutine and doesn't block.
+func SetClipboardText(text string) {
+	runOnMain(func() {
+		clipboard, err := gtk.ClipboardGet(gdk.SELECTION_CLIPBOARD)
+		if err != nil {
+			log.Println("Cannot get clipboard:", err)
+			return
+		}
+
+		clipboard.SetText(text)
+	})
+}
+
+// WatchClipboard calls changed with the text of the clipboard each time its
+// content changes. It can be called from any goroutine and doesn't block.
+func WatchClipboard(changed func(text string)) {
+	runOnMain(func() {
+		clipboard, err := gtk.ClipboardGet(gdk.SELECTION_CLIPBOARD)
+		if err != nil {
+			log.Println("Cannot get clipboard:", err)
+			return
+		}
+
+		clipboard.Connect("owner-change", func() {
+			text, err := clipboard.WaitForText()
+			if err != nil {
+				// The clipboard doesn't contain text
+				return
+			}
+
+			// changed takes the handler's lock, don't block the GTK main loop
+			go changed(text)
+		})
+	})
+}
@@ -0,0 +1,206 @@
+package ui
+
+import (
+	"github.com/conformal/gotk3/gtk"
+	"github.com/emersion/gnomeconnect/conversations"
+	"github.com/emersion/gnomeconnect/plugins"
+	"github.com/emersion/go-kdeconnect/network"
+	"log"
+	"strings"
+	"time"
+)
+
+const previewLength = 40
+
+// sendSms sends an SMS from a device, and saves it in the conversations store.
+func sendSms(device *network.Device, store *conversations.Store, number, message string) error {
+	log.Println("Send SMS", device, number)
+
+	if err := plugins.SendSms(device, number, message); err != nil {
+		return err
+	}
+
+	if store == nil {
+		return nil
+	}
+
+	return store.Add(device.Id, &conversations.Message{
+		Address: number,
+		Body:    message,
+		Date:    time.Now(),
+		Sent:    true,
+	})
+}
+
+func (ui *Ui) contactName(number string) string {
+	if ui.plugins.Contacts == nil {
+		return number
+	}
+	return ui.plugins.Contacts.Resolve(number, "")
+}
+
+func (ui *Ui) selectedConversation() *conversations.Conversation {
+	if ui.selectedDevice == nil || ui.selectedAddress == "" {
+		return nil
+	}
+
+	for _, c := range ui.plugins.Store.Conversations(ui.selectedDevice.Id) {
+		if c.Address == ui.selectedAddress {
+			return &c
+		}
+	}
+	return nil
+}
+
+func (ui *Ui) updateConversations() {
+	device := ui.selectedDevice
+	if device == nil || !device.Paired || device.Type != "phone" || ui.plugins.Store == nil {
+		ui.conversationsBox.SetVisible(false)
+		return
+	}
+	ui.conversationsBox.SetVisible(true)
+
+	for _, row := range ui.threadsRows {
+		row.Destroy()
+	}
+	ui.threadsRows = map[string]*gtk.ListBoxRow{}
+
+	for _, c := range ui.plugins.Store.Conversations(device.Id) {
+		row, _ := gtk.ListBoxRowNew()
+		ui.threadsList.Add(row)
+
+		preview := ""
+		if m := c.LastMessage(); m != nil {
+			preview = strings.Replace(m.Body, "\n", " ", -1)
+			if runes := []rune(preview); len(runes) > previewLength {
+				preview = string(runes[:previewLength]) + "…"
+			}
+		}
+
+		l, _ := gtk.LabelNew(ui.contactName(c.Address) + "\n" + preview)
+		l.Set("xalign", 0)
+		l.SetPadding(10, 5)
+		row.Add(l)
+
+		ui.threadsRows[c.Address] = row
+	}
+	ui.threadsList.ShowAll()
+
+	ui.updateMessages()
+}
+
+func (ui *Ui) updateMessages() {
+	for _, row := range ui.messagesRows {
+		row.Destroy()
+	}
+	ui.messagesRows = nil
+
+	conv := ui.selectedConversation()
+	ui.composerBox.SetVisible(ui.selectedAddress != "")
+	if conv == nil {
+		return
+	}
+
+	for _, m := range conv.Messages {
+		row, _ := gtk.ListBoxRowNew()
+		row.SetSelectable(false)
+		ui.messagesList.Add(row)
+
+		l, _ := gtk.LabelNew(m.Body + "\n" + m.Date.Format("Jan 2 15:04"))
+		l.SetLineWrap(true)
+		l.SetSelectable(true)
+		l.SetPadding(10, 5)
+		if m.Sent {
+			l.Set("xalign", 1)
+		} else {
+			l.Set("xalign", 0)
+		}
+		row.Add(l)
+
+		ui.messagesRows = append(ui.messagesRows, row)
+	}
+	ui.messagesList.ShowAll()
+}
+
+func (ui *Ui) selectConversation(address string) {
+	ui.selectedAddress = address
+	ui.updateMessages()
+
+	conv := ui.selectedConversation()
+	if conv != nil && conv.ThreadId != 0 && ui.plugins.Sms != nil {
+		if err := ui.plugins.Sms.SendRequestConversation(ui.selectedDevice, conv.ThreadId); err != nil {
+			log.Println("Cannot request conversation:", err)
+		}
+	}
+}
+
+func (ui *Ui) initConversationsView() *gtk.Box {
+	hbox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 0)
+	ui.conversationsBox = hbox
+
+	scroller, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroller.SetSizeRequest(sidebarWidth, -1)
+	hbox.PackStart(scroller, false, true, 0)
+
+	list, _ := gtk.ListBoxNew()
+	scroller.Add(list)
+	ui.threadsList = list
+
+	list.Connect("row-selected", func(box *gtk.ListBox, row *gtk.ListBoxRow) {
+		if row == nil {
+			return
+		}
+		index := row.GetIndex()
+
+		for address, r := range ui.threadsRows {
+			if index == r.GetIndex() {
+				ui.selectConversation(address)
+				return
+			}
+		}
+	})
+
+	sep, _ := gtk.SeparatorNew(gtk.ORIENTATION_VERTICAL)
+	hbox.PackStart(sep, false, true, 0)
+
+	vbox, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 0)
+	hbox.PackStart(vbox, true, true, 0)
+
+	scroller, _ = gtk.ScrolledWindowNew(nil, nil)
+	vbox.PackStart(scroller, true, true, 0)
+
+	list, _ = gtk.ListBoxNew()
+	scroller.Add(list)
+	ui.messagesList = list
+
+	composer, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
+	composer.SetBorderWidth(5)
+	vbox.PackEnd(composer, false, true, 0)
+	ui.composerBox = composer
+
+	entry, _ := gtk.EntryNew()
+	entry.SetPlaceholderText("Message")
+	composer.PackStart(entry, true, true, 0)
+
+	sendBtn, _ := gtk.ButtonNewWithLabel("Send")
+	composer.PackStart(sendBtn, false, false, 0)
+
+	submit := func() {
+		message, _ := entry.GetText()
+		if message == "" || ui.selectedAddress == "" {
+			return
+		}
+
+		err := sendSms(ui.selectedDevice, ui.plugins.Store, ui.selectedAddress, message)
+		if err != nil {
+			log.Println("Cannot send SMS:", err)
+			return
+		}
+		entry.SetText("")
+	}
+
+	entry.Connect("activate", submit)
+	sendBtn.Connect("clicked", submit)
+
+	return hbox
+}
@@ -0,0 +1,61 @@
+package ui
+
+import (
+	"github.com/conformal/gotk3/gtk"
+)
+
+// ShowReplyDialog opens a small window with a text entry. send is called with
+// the entered text when the user validates it. It can be called from any
+// goroutine and doesn't block.
+func ShowReplyDialog(title, text string, send func(message string)) {
+	runOnMain(func() {
+		showReplyDialog(title, text, send)
+	})
+}
+
+func showReplyDialog(title, text string, send func(message string)) {
+	win, _ := gtk.WindowNew(gtk.WINDOW_TOPLEVEL)
+	win.SetTitle(title)
+	win.SetDefaultSize(400, -1)
+
+	headerbar, _ := gtk.HeaderBarNew()
+	headerbar.SetTitle(title)
+	headerbar.SetShowCloseButton(true)
+	win.SetTitlebar(headerbar)
+
+	vbox, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 10)
+	vbox.SetBorderWidth(10)
+	win.Add(vbox)
+
+	if text != "" {
+		l, _ := gtk.LabelNew(text)
+		l.Set("xalign", 0)
+		l.SetLineWrap(true)
+		vbox.PackStart(l, false, true, 0)
+	}
+
+	hbox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
+	vbox.PackStart(hbox, false, true, 0)
+
+	entry, _ := gtk.EntryNew()
+	hbox.PackStart(entry, true, true, 0)
+
+	sendBtn, _ := gtk.ButtonNewWithLabel("Send")
+	hbox.PackStart(sendBtn, false, false, 0)
+
+	submit := func() {
+		message, _ := entry.GetText()
+		if message == "" {
+			return
+		}
+
+		send(message)
+		win.Destroy()
+	}
+
+	entry.Connect("activate", submit)
+	sendBtn.Connect("clicked", submit)
+
+	win.ShowAll()
+	win.Present()
+}
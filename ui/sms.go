@@ -0,0 +1,98 @@
+package ui
+
+import (
+	"github.com/conformal/gotk3/gtk"
+	"github.com/emersion/gnomeconnect/contacts"
+	"github.com/emersion/gnomeconnect/conversations"
+	"github.com/emersion/go-kdeconnect/network"
+	"log"
+)
+
+// ShowSmsDialog opens a window to send an SMS from a device. The recipient can
+// be a phone number or a contact name if resolver is not nil. Sent messages are
+// saved in store, if not nil.
+func ShowSmsDialog(device *network.Device, resolver *contacts.Resolver, store *conversations.Store) {
+	initGtk()
+
+	title := "Send SMS from " + device.Name
+
+	win, _ := gtk.WindowNew(gtk.WINDOW_TOPLEVEL)
+	win.SetTitle(title)
+	win.SetDefaultSize(400, -1)
+
+	headerbar, _ := gtk.HeaderBarNew()
+	headerbar.SetTitle(title)
+	headerbar.SetShowCloseButton(true)
+	win.SetTitlebar(headerbar)
+
+	vbox, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 10)
+	vbox.SetBorderWidth(10)
+	win.Add(vbox)
+
+	numberEntry, _ := gtk.EntryNew()
+	numberEntry.SetPlaceholderText("Phone number or contact name")
+	vbox.PackStart(numberEntry, false, true, 0)
+
+	contactLabel, _ := gtk.LabelNew("")
+	contactLabel.Set("xalign", 0)
+	vbox.PackStart(contactLabel, false, true, 0)
+
+	hbox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
+	vbox.PackStart(hbox, false, true, 0)
+
+	messageEntry, _ := gtk.EntryNew()
+	messageEntry.SetPlaceholderText("Message")
+	hbox.PackStart(messageEntry, true, true, 0)
+
+	sendBtn, _ := gtk.ButtonNewWithLabel("Send")
+	hbox.PackStart(sendBtn, false, false, 0)
+
+	// recipient returns the phone number to send the message to
+	recipient := func() string {
+		text, _ := numberEntry.GetText()
+		if resolver != nil {
+			if number, ok := resolver.Find(text); ok {
+				return number
+			}
+		}
+		if contacts.IsPhoneNumber(text) {
+			return text
+		}
+		return ""
+	}
+
+	numberEntry.Connect("changed", func() {
+		text, _ := numberEntry.GetText()
+		number := recipient()
+
+		if resolver == nil || number == "" {
+			contactLabel.SetText("")
+		} else if number != text {
+			contactLabel.SetText(number)
+		} else if name, ok := resolver.Lookup(number); ok {
+			contactLabel.SetText(name)
+		} else {
+			contactLabel.SetText("")
+		}
+	})
+
+	submit := func() {
+		number := recipient()
+		message, _ := messageEntry.GetText()
+		if number == "" || message == "" {
+			return
+		}
+
+		if err := sendSms(device, store, number, message); err != nil {
+			log.Println("Cannot send SMS:", err)
+			return
+		}
+		win.Destroy()
+	}
+
+	messageEntry.Connect("activate", submit)
+	sendBtn.Connect("clicked", submit)
+
+	win.ShowAll()
+	win.Present()
+}
@@ -1,22 +1,74 @@
 package ui
 
 import (
+	"github.com/conformal/gotk3/glib"
 	"github.com/conformal/gotk3/gtk"
+	"github.com/emersion/gnomeconnect/contacts"
+	"github.com/emersion/gnomeconnect/conversations"
+	"github.com/emersion/gnomeconnect/handlers"
+	"github.com/emersion/gnomeconnect/plugins"
 	"github.com/emersion/gnomeconnect/utils"
 	"github.com/emersion/go-kdeconnect/engine"
 	"github.com/emersion/go-kdeconnect/network"
 	"github.com/emersion/go-kdeconnect/plugin"
 	"log"
+	"strconv"
+	"sync"
 )
 
 type PluginCollection struct {
-	Sftp *plugin.Sftp
+	Ping     *plugin.Ping
+	Sftp     *plugin.Sftp
+	Battery  *handlers.Battery
+	Contacts *contacts.Resolver
+	Sms      *plugins.Sms
+	Store    *conversations.Store
+	Share    *handlers.Share
+	Settings *utils.Settings
 }
 
 const (
 	sidebarWidth = 200
 )
 
+var gtkOnce sync.Once
+
+// initGtk starts the GTK main loop. The loop is shared by the main window and
+// by the dialogs opened from notifications, so it is never stopped.
+func initGtk() {
+	gtkOnce.Do(func() {
+		gtk.Init(nil)
+		go gtk.Main()
+	})
+}
+
+// runOnMain schedules f on the GTK main loop. GTK isn't thread-safe: code
+// running on other goroutines must not touch widgets directly.
+func runOnMain(f func()) {
+	initGtk()
+
+	if _, err := glib.IdleAdd(f); err != nil {
+		log.Println("Cannot schedule GTK callback:", err)
+	}
+}
+
+// runOnMainSync runs f on the GTK main loop and waits for it to return. It
+// must not be called from the main loop itself.
+func runOnMainSync(f func()) {
+	initGtk()
+
+	done := make(chan struct{})
+	_, err := glib.IdleAdd(func() {
+		defer close(done)
+		f()
+	})
+	if err != nil {
+		log.Println("Cannot schedule GTK callback:", err)
+		return
+	}
+	<-done
+}
+
 type Ui struct {
 	win            *gtk.Window
 	selectedDevice *network.Device
@@ -33,6 +85,26 @@ type Ui struct {
 	deviceIcon        *gtk.Image
 	pairBtn           *gtk.Button
 	browseBtn         *gtk.Button
+	pingBtn           *gtk.Button
+	ringBtn           *gtk.Button
+	smsBtn            *gtk.Button
+	sendFileBtn       *gtk.Button
+	batteryBox        *gtk.Box
+	batteryIcon       *gtk.Image
+	batteryLabel      *gtk.Label
+	settingsBox       *gtk.Box
+	clipboardSwitch   *gtk.Switch
+
+	conversationsBox *gtk.Box
+	threadsList      *gtk.ListBox
+	threadsRows      map[string]*gtk.ListBoxRow
+	messagesList     *gtk.ListBox
+	messagesRows     []*gtk.ListBoxRow
+	composerBox      *gtk.Box
+	selectedAddress  string
+
+	batteryUpdates      <-chan *handlers.BatteryUpdate
+	conversationUpdates <-chan string
 
 	Available       chan *network.Device
 	Unavailable     chan *network.Device
@@ -44,18 +116,31 @@ type Ui struct {
 }
 
 func (ui *Ui) Raise() {
-	ui.win.Present()
+	runOnMain(func() {
+		ui.win.Present()
+	})
 }
 
 func (ui *Ui) SelectDevice(device *network.Device) {
-	ui.addDevice(device)
+	runOnMain(func() {
+		ui.addDevice(device)
 
-	if row, ok := ui.devicesRows[device.Id]; ok {
-		ui.devicesList.SelectRow(row)
-	}
+		if row, ok := ui.devicesRows[device.Id]; ok {
+			ui.devicesList.SelectRow(row)
+		}
+	})
 }
 
 func (ui *Ui) selectDevice(device *network.Device) {
+	if device == nil || ui.selectedDevice == nil || device.Id != ui.selectedDevice.Id {
+		ui.selectedAddress = ""
+
+		if device != nil && device.Paired && device.Type == "phone" && ui.plugins.Sms != nil {
+			if err := ui.plugins.Sms.SendRequestConversations(device); err != nil {
+				log.Println("Cannot request conversations:", err)
+			}
+		}
+	}
 	ui.selectedDevice = device
 
 	ui.deviceBox.SetVisible(device != nil)
@@ -67,6 +152,14 @@ func (ui *Ui) selectDevice(device *network.Device) {
 	ui.deviceNameLabel.SetMarkup("<big>" + device.Name + "</big>")
 	ui.deviceIcon.SetFromIconName(utils.GetDeviceIcon(device), gtk.ICON_SIZE_DIALOG)
 	ui.browseBtn.SetVisible(device.Paired)
+	ui.pingBtn.SetVisible(device.Paired && ui.plugins.Ping != nil)
+	ui.ringBtn.SetVisible(device.Paired)
+	ui.smsBtn.SetVisible(device.Paired && device.Type == "phone")
+	ui.sendFileBtn.SetVisible(device.Paired && ui.plugins.Share != nil)
+	ui.settingsBox.SetVisible(device.Paired && ui.plugins.Settings != nil)
+	if ui.plugins.Settings != nil {
+		ui.clipboardSwitch.SetActive(ui.plugins.Settings.Device(device.Id).SyncClipboard)
+	}
 
 	if device.Paired {
 		ui.deviceStatusLabel.SetText("Device connected")
@@ -75,6 +168,54 @@ func (ui *Ui) selectDevice(device *network.Device) {
 		ui.deviceStatusLabel.SetText("Device available")
 		ui.pairBtn.SetLabel("Pair")
 	}
+
+	ui.updateBattery()
+	ui.updateConversations()
+}
+
+func batteryIconName(state handlers.BatteryState) string {
+	var level string
+	switch {
+	case state.Charge >= 100:
+		level = "full"
+	case state.Charge >= 60:
+		level = "good"
+	case state.Charge >= 30:
+		level = "low"
+	case state.Charge >= 10:
+		level = "caution"
+	default:
+		level = "empty"
+	}
+
+	if state.IsCharging {
+		if level == "full" {
+			return "battery-full-charged-symbolic"
+		}
+		return "battery-" + level + "-charging-symbolic"
+	}
+	return "battery-" + level + "-symbolic"
+}
+
+func (ui *Ui) updateBattery() {
+	if ui.selectedDevice == nil || !ui.selectedDevice.Paired || ui.plugins.Battery == nil {
+		ui.batteryBox.SetVisible(false)
+		return
+	}
+
+	state, ok := ui.plugins.Battery.State(ui.selectedDevice.Id)
+	ui.batteryBox.SetVisible(ok)
+	if !ok {
+		return
+	}
+
+	text := strconv.Itoa(state.Charge) + "%"
+	if state.IsCharging {
+		text += " (charging)"
+	}
+
+	ui.batteryIcon.SetFromIconName(batteryIconName(state), gtk.ICON_SIZE_BUTTON)
+	ui.batteryLabel.SetText(text)
 }
 
 func (ui *Ui) updateDevicesList() {
@@ -145,6 +286,19 @@ func (ui *Ui) initDeviceView() *gtk.Box {
 	nameBox.PackStart(l, true, true, 0)
 	ui.deviceStatusLabel = l
 
+	batteryBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
+	nameBox.PackStart(batteryBox, true, true, 0)
+	ui.batteryBox = batteryBox
+
+	img, _ = gtk.ImageNew()
+	batteryBox.PackStart(img, false, true, 0)
+	ui.batteryIcon = img
+
+	l, _ = gtk.LabelNew("")
+	l.Set("xalign", 0)
+	batteryBox.PackStart(l, true, true, 0)
+	ui.batteryLabel = l
+
 	browseBtn, _ := gtk.ButtonNewFromIconName("document-open-symbolic", gtk.ICON_SIZE_BUTTON)
 	hbox.PackStart(browseBtn, false, false, 0)
 	ui.browseBtn = browseBtn
@@ -154,6 +308,46 @@ func (ui *Ui) initDeviceView() *gtk.Box {
 		ui.plugins.Sftp.SendStartBrowsing(ui.selectedDevice)
 	})
 
+	pingBtn, _ := gtk.ButtonNewFromIconName("network-transmit-symbolic", gtk.ICON_SIZE_BUTTON)
+	pingBtn.SetTooltipText("Send ping")
+	hbox.PackStart(pingBtn, false, false, 5)
+	ui.pingBtn = pingBtn
+
+	pingBtn.Connect("clicked", func() {
+		log.Println("Ping device", ui.selectedDevice)
+		ui.plugins.Ping.SendPing(ui.selectedDevice)
+	})
+
+	ringBtn, _ := gtk.ButtonNewFromIconName("audio-volume-high-symbolic", gtk.ICON_SIZE_BUTTON)
+	ringBtn.SetTooltipText("Ring device")
+	hbox.PackStart(ringBtn, false, false, 5)
+	ui.ringBtn = ringBtn
+
+	ringBtn.Connect("clicked", func() {
+		log.Println("Ring device", ui.selectedDevice)
+		if err := plugins.SendFindMyPhoneRequest(ui.selectedDevice); err != nil {
+			log.Println("Cannot ring device:", err)
+		}
+	})
+
+	sendFileBtn, _ := gtk.ButtonNewFromIconName("document-send-symbolic", gtk.ICON_SIZE_BUTTON)
+	sendFileBtn.SetTooltipText("Send file…")
+	hbox.PackStart(sendFileBtn, false, false, 5)
+	ui.sendFileBtn = sendFileBtn
+
+	sendFileBtn.Connect("clicked", func() {
+		ui.sendFile(ui.selectedDevice)
+	})
+
+	smsBtn, _ := gtk.ButtonNewFromIconName("mail-message-new-symbolic", gtk.ICON_SIZE_BUTTON)
+	smsBtn.SetTooltipText("Send SMS")
+	hbox.PackStart(smsBtn, false, false, 5)
+	ui.smsBtn = smsBtn
+
+	smsBtn.Connect("clicked", func() {
+		ShowSmsDialog(ui.selectedDevice, ui.plugins.Contacts, ui.plugins.Store)
+	})
+
 	pairBtn, _ := gtk.ButtonNew()
 	hbox.PackStart(pairBtn, false, false, 5)
 	ui.pairBtn = pairBtn
@@ -168,9 +362,69 @@ func (ui *Ui) initDeviceView() *gtk.Box {
 		}
 	})
 
+	vbox.PackStart(ui.initDeviceSettings(), false, true, 10)
+
+	sep, _ := gtk.SeparatorNew(gtk.ORIENTATION_HORIZONTAL)
+	vbox.PackStart(sep, false, true, 0)
+
+	conversationsView := ui.initConversationsView()
+	vbox.PackStart(conversationsView, true, true, 0)
+
 	return vbox
 }
 
+func (ui *Ui) initDeviceSettings() *gtk.Box {
+	hbox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+	ui.settingsBox = hbox
+
+	l, _ := gtk.LabelNew("Synchronize clipboard")
+	l.Set("xalign", 0)
+	hbox.PackStart(l, true, true, 0)
+
+	clipboardSwitch, _ := gtk.SwitchNew()
+	hbox.PackStart(clipboardSwitch, false, false, 0)
+	ui.clipboardSwitch = clipboardSwitch
+
+	clipboardSwitch.Connect("notify::active", func() {
+		if ui.selectedDevice == nil {
+			return
+		}
+
+		ds := ui.plugins.Settings.Device(ui.selectedDevice.Id)
+		active := clipboardSwitch.GetActive()
+		if ds.SyncClipboard == active {
+			// The switch has been updated to match the selected device
+			return
+		}
+
+		log.Println("Synchronize clipboard", ui.selectedDevice, active)
+
+		ds.SyncClipboard = active
+		ui.plugins.Settings.SetDevice(ui.selectedDevice.Id, ds)
+		if err := utils.SaveSettings(ui.plugins.Settings); err != nil {
+			log.Println("Cannot save settings:", err)
+		}
+	})
+
+	return hbox
+}
+
+func (ui *Ui) sendFile(device *network.Device) {
+	dialog, _ := gtk.FileChooserDialogNewWith2Buttons("Send file to "+device.Name, ui.win, gtk.FILE_CHOOSER_ACTION_OPEN, "Cancel", gtk.RESPONSE_CANCEL, "Send", gtk.RESPONSE_ACCEPT)
+	defer dialog.Destroy()
+
+	if gtk.ResponseType(dialog.Run()) != gtk.RESPONSE_ACCEPT {
+		return
+	}
+
+	path := dialog.GetFilename()
+	log.Println("Send file", device, path)
+
+	if err := ui.plugins.Share.SendFile(device, path); err != nil {
+		log.Println("Cannot send file:", err)
+	}
+}
+
 func (ui *Ui) initTitlebar() *gtk.Box {
 	hbox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 0)
 
@@ -195,7 +449,12 @@ func (ui *Ui) init() {
 	win.SetTitle("GNOMEConnect")
 	win.SetDefaultSize(800, 600)
 	win.Connect("destroy", func() {
-		gtk.MainQuit()
+		if ui.plugins.Battery != nil {
+			ui.plugins.Battery.Unsubscribe(ui.batteryUpdates)
+		}
+		if ui.plugins.Store != nil {
+			ui.plugins.Store.Unsubscribe(ui.conversationUpdates)
+		}
 		ui.Quit <- true
 	})
 	ui.win = win
@@ -223,6 +482,12 @@ func (ui *Ui) addDevice(device *network.Device) {
 	if _, ok := ui.devices[device.Id]; !ok {
 		ui.devices[device.Id] = device
 		ui.updateDevicesList()
+
+		if device.Paired && ui.plugins.Battery != nil {
+			if err := ui.plugins.Battery.Request(device); err != nil {
+				log.Println("Cannot request battery state:", err)
+			}
+		}
 	}
 }
 
@@ -237,26 +502,48 @@ func (ui *Ui) removeDevice(device *network.Device) {
 	}
 }
 
+// listen forwards device, battery and conversation updates to the GTK main
+// loop, where widgets are updated.
 func (ui *Ui) listen() {
 	for {
 		select {
 		case device := <-ui.Available:
-			ui.addDevice(device)
+			runOnMain(func() {
+				ui.addDevice(device)
+				ui.selectDevice(ui.selectedDevice)
+			})
 		case device := <-ui.Unavailable:
-			ui.removeDevice(device)
+			runOnMain(func() {
+				ui.removeDevice(device)
+				ui.selectDevice(ui.selectedDevice)
+			})
 		case device := <-ui.Connected:
-			ui.addDevice(device)
+			runOnMain(func() {
+				ui.addDevice(device)
+				ui.selectDevice(ui.selectedDevice)
+			})
 		case device := <-ui.Disconnected:
-			ui.addDevice(device)
+			runOnMain(func() {
+				ui.addDevice(device)
+				ui.selectDevice(ui.selectedDevice)
+			})
+		case update := <-ui.batteryUpdates:
+			runOnMain(func() {
+				if ui.selectedDevice != nil && update.Device.Id == ui.selectedDevice.Id {
+					ui.selectDevice(ui.selectedDevice)
+				}
+			})
+		case deviceId := <-ui.conversationUpdates:
+			runOnMain(func() {
+				if ui.selectedDevice != nil && deviceId == ui.selectedDevice.Id {
+					ui.selectDevice(ui.selectedDevice)
+				}
+			})
 		}
-
-		ui.selectDevice(ui.selectedDevice)
 	}
 }
 
 func New(engine *engine.Engine, plugins *PluginCollection) *Ui {
-	gtk.Init(nil)
-
 	ui := &Ui{
 		engine:  engine,
 		plugins: plugins,
@@ -271,8 +558,14 @@ func New(engine *engine.Engine, plugins *PluginCollection) *Ui {
 		Quit: make(chan bool),
 	}
 
-	ui.init()
-	go gtk.Main()
+	if plugins.Battery != nil {
+		ui.batteryUpdates = plugins.Battery.Subscribe()
+	}
+	if plugins.Store != nil {
+		ui.conversationUpdates = plugins.Store.Subscribe()
+	}
+
+	runOnMainSync(ui.init)
 	go ui.listen()
 
 	return ui
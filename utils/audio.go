@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// IsAudioMuted checks whether the default PulseAudio sink is muted.
+func IsAudioMuted() (bool, error) {
+	out, err := exec.Command("pactl", "get-sink-mute", "@DEFAULT_SINK@").Output()
+	if err != nil {
+		return false, err
+	}
+
+	return strings.Contains(string(out), "yes"), nil
+}
+
+// MuteAudio mutes or unmutes the default PulseAudio sink.
+func MuteAudio(mute bool) error {
+	value := "0"
+	if mute {
+		value = "1"
+	}
+
+	return exec.Command("pactl", "set-sink-mute", "@DEFAULT_SINK@", value).Run()
+}
+
+// GetAudioVolume returns the volume of the default PulseAudio sink, in percent.
+func GetAudioVolume() (int, error) {
+	out, err := exec.Command("pactl", "get-sink-volume", "@DEFAULT_SINK@").Output()
+	if err != nil {
+		return 0, err
+	}
+
+	// e.g. "Volume: front-left: 32768 /  50% / -18.06 dB, ..."
+	for _, field := range strings.Fields(string(out)) {
+		if strings.HasSuffix(field, "%") {
+			return strconv.Atoi(strings.TrimSuffix(field, "%"))
+		}
+	}
+
+	return 0, errors.New("Cannot parse sink volume")
+}
+
+// SetAudioVolume sets the volume of the default PulseAudio sink, in percent.
+func SetAudioVolume(percent int) error {
+	return exec.Command("pactl", "set-sink-volume", "@DEFAULT_SINK@", strconv.Itoa(percent)+"%").Run()
+}
+
+// SoundPlayer plays a sound file in a loop through PulseAudio, at maximum
+// volume. The volume is restored when it is stopped.
+type SoundPlayer struct {
+	Path string
+
+	locker sync.Mutex
+	stop   chan struct{}
+	cmd    *exec.Cmd
+	// Volume and mute state before playing, volume is negative if unknown
+	volume      int
+	muted       bool
+	restoreMute bool
+}
+
+func (p *SoundPlayer) Play() error {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.stop != nil {
+		// Already playing
+		return nil
+	}
+
+	if _, err := os.Stat(p.Path); err != nil {
+		return err
+	}
+
+	muted, err := IsAudioMuted()
+	if err != nil {
+		log.Println("Warning: cannot get mute state:", err)
+	}
+	p.muted = muted
+	p.restoreMute = err == nil
+
+	volume, err := GetAudioVolume()
+	if err != nil {
+		log.Println("Warning: cannot get volume:", err)
+		volume = -1
+	}
+	p.volume = volume
+
+	// Play the sound anyway if the volume can't be changed
+	if err := MuteAudio(false); err != nil {
+		log.Println("Warning: cannot unmute audio:", err)
+	}
+	if err := SetAudioVolume(100); err != nil {
+		log.Println("Warning: cannot set volume:", err)
+	}
+
+	p.stop = make(chan struct{})
+	go p.loop(p.stop)
+	return nil
+}
+
+func (p *SoundPlayer) loop(stop chan struct{}) {
+	for {
+		p.locker.Lock()
+		select {
+		case <-stop:
+			p.locker.Unlock()
+			return
+		default:
+		}
+
+		cmd := exec.Command("paplay", p.Path)
+		if err := cmd.Start(); err != nil {
+			p.locker.Unlock()
+			log.Println("Cannot play sound:", err)
+			return
+		}
+		p.cmd = cmd
+		p.locker.Unlock()
+
+		if err := cmd.Wait(); err != nil {
+			select {
+			case <-stop:
+				// Killed by Stop
+			default:
+				log.Println("Cannot play sound:", err)
+			}
+			return
+		}
+	}
+}
+
+func (p *SoundPlayer) Stop() error {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.stop == nil {
+		return nil
+	}
+
+	close(p.stop)
+	p.stop = nil
+
+	if p.cmd != nil && p.cmd.Process != nil {
+		p.cmd.Process.Kill()
+	}
+	p.cmd = nil
+
+	if p.volume >= 0 {
+		if err := SetAudioVolume(p.volume); err != nil {
+			return err
+		}
+	}
+	if p.restoreMute {
+		return MuteAudio(p.muted)
+	}
+	return nil
+}
+
+// NewSoundPlayer creates a player for a sound file.
+func NewSoundPlayer(path string) *SoundPlayer {
+	return &SoundPlayer{Path: path}
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"github.com/emersion/go-kdeconnect/network"
+)
+
+var (
+	ErrDeviceNotPaired     = errors.New("Device is not paired")
+	ErrNoDevicePublicKey   = errors.New("Device public key is unknown")
+	ErrCertificateMismatch = errors.New("Device certificate doesn't match its public key")
+)
+
+// parseRSAPublicKey decodes a PEM-encoded RSA public key, either in PKIX or
+// PKCS #1 form.
+func parseRSAPublicKey(raw []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("Invalid public key PEM")
+	}
+
+	if pub, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		if rsaPub, ok := pub.(*rsa.PublicKey); ok {
+			return rsaPub, nil
+		}
+		return nil, errors.New("Public key is not an RSA key")
+	}
+
+	return x509.ParsePKCS1PublicKey(block.Bytes)
+}
+
+// VerifyDeviceCertificate checks the certificate presented by a device for a
+// payload transfer. Only paired devices are accepted, and the certificate's
+// key must be the one exchanged when pairing.
+func VerifyDeviceCertificate(device *network.Device, cert *x509.Certificate) error {
+	if !device.Paired {
+		return ErrDeviceNotPaired
+	}
+	if device.PublicKey == nil {
+		return ErrNoDevicePublicKey
+	}
+
+	raw, err := device.PublicKey.Marshal()
+	if err != nil {
+		return err
+	}
+	known, err := parseRSAPublicKey(raw)
+	if err != nil {
+		return err
+	}
+
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok || pub.E != known.E || pub.N.Cmp(known.N) != 0 {
+		return ErrCertificateMismatch
+	}
+	return nil
+}
@@ -1,13 +1,23 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
-	"github.com/allan-simon/go-singleinstance"
+	"encoding/pem"
+	"errors"
 	"github.com/emersion/go-kdeconnect/crypto"
 	"github.com/emersion/go-kdeconnect/engine"
 	"io/ioutil"
+	"math/big"
 	"os"
-	"syscall"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
 )
 
 func GetConfigDir() (configDir string, err error) {
@@ -25,33 +35,36 @@ func GetConfigDir() (configDir string, err error) {
 	return
 }
 
-func CreateLockFile() error {
+// GetContactsDir returns the directory where vCard files can be stored to
+// resolve phone numbers.
+func GetContactsDir() (string, error) {
 	configDir, err := GetConfigDir()
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	_, err = singleinstance.CreateLockFile(configDir + "/server.lock")
-	return err
+	return configDir + "/contacts", nil
 }
 
-func NotifyLockingPid() error {
+// GetConversationsDir returns the directory where SMS conversations are saved.
+func GetConversationsDir() (string, error) {
 	configDir, err := GetConfigDir()
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	pid, err := singleinstance.GetLockFilePid(configDir + "/server.lock")
-	if err != nil {
-		return err
-	}
+	return configDir + "/conversations", nil
+}
 
-	proc, err := os.FindProcess(pid)
+// GetCommandsDir returns the directory containing the commands devices can
+// run, in one file per device.
+func GetCommandsDir() (string, error) {
+	configDir, err := GetConfigDir()
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return proc.Signal(syscall.SIGUSR1)
+	return configDir + "/commands", nil
 }
 
 func LoadPrivateKey() (priv *crypto.PrivateKey, err error) {
@@ -82,6 +95,56 @@ func LoadPrivateKey() (priv *crypto.PrivateKey, err error) {
 	return
 }
 
+// LoadCertificate loads the TLS certificate used for payload transfers. If it
+// doesn't exist, a self-signed one is generated.
+func LoadCertificate() (cert tls.Certificate, err error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return
+	}
+
+	certFile := configDir + "/certificate.pem"
+	keyFile := configDir + "/certificate-key.pem"
+
+	cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+	if err == nil {
+		return
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			Organization: []string{"GNOMEConnect"},
+		},
+		NotBefore:   time.Now(),
+		NotAfter:    time.Now().AddDate(10, 0, 0),
+		KeyUsage:    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return
+	}
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	if err = ioutil.WriteFile(certFile, certPem, 0644); err != nil {
+		return
+	}
+	if err = ioutil.WriteFile(keyFile, keyPem, 0600); err != nil {
+		return
+	}
+
+	return tls.X509KeyPair(certPem, keyPem)
+}
+
 func LoadKnownDevices() (knownDevices []*engine.KnownDevice, err error) {
 	configDir, err := GetConfigDir()
 	if err != nil {
@@ -113,3 +176,115 @@ func SaveKnownDevices(knownDevices []*engine.KnownDevice) (err error) {
 	err = enc.Encode(knownDevices)
 	return
 }
+
+// DeviceSettings contains per-device preferences.
+type DeviceSettings struct {
+	// Show a notification when the device's battery is fully charged
+	NotifyFullyCharged bool `json:"notifyFullyCharged"`
+	// Pause media players during calls
+	PauseMediaOnCall bool `json:"pauseMediaOnCall"`
+	// Mute the desktop during calls
+	MuteOnCall bool `json:"muteOnCall"`
+	// Synchronize the clipboard with the device
+	SyncClipboard bool `json:"syncClipboard"`
+}
+
+type Settings struct {
+	// Directory where files received from devices are saved. Defaults to the
+	// XDG download directory.
+	DownloadDir string                     `json:"downloadDir,omitempty"`
+	Devices     map[string]*DeviceSettings `json:"devices"`
+
+	locker sync.Mutex
+}
+
+// Device returns a copy of the settings of a device. If there are no settings
+// for this device yet, defaults are returned.
+func (s *Settings) Device(id string) DeviceSettings {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if ds, ok := s.Devices[id]; ok {
+		return *ds
+	}
+	return DeviceSettings{}
+}
+
+// SetDevice replaces the settings of a device.
+func (s *Settings) SetDevice(id string, ds DeviceSettings) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if s.Devices == nil {
+		s.Devices = map[string]*DeviceSettings{}
+	}
+	s.Devices[id] = &ds
+}
+
+// GetDownloadDir returns the directory where received files are saved, and
+// creates it if needed.
+func GetDownloadDir(settings *Settings) (dir string, err error) {
+	settings.locker.Lock()
+	dir = settings.DownloadDir
+	settings.locker.Unlock()
+
+	if dir == "" {
+		out, err := exec.Command("xdg-user-dir", "DOWNLOAD").Output()
+		if err == nil {
+			dir = strings.TrimSpace(string(out))
+		}
+	}
+	if dir == "" {
+		homeDir := os.Getenv("HOME")
+		if homeDir == "" {
+			return "", errors.New("Cannot find home directory")
+		}
+		dir = homeDir + "/Downloads"
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	return
+}
+
+// LoadSettings loads settings from the config directory. If the settings file
+// doesn't exist, defaults are returned.
+func LoadSettings() (settings *Settings, err error) {
+	settings = &Settings{Devices: map[string]*DeviceSettings{}}
+
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return
+	}
+
+	settingsFile, err := os.Open(configDir + "/settings.json")
+	if os.IsNotExist(err) {
+		return settings, nil
+	} else if err != nil {
+		return
+	}
+	defer settingsFile.Close()
+
+	dec := json.NewDecoder(settingsFile)
+	err = dec.Decode(settings)
+	return
+}
+
+func SaveSettings(settings *Settings) (err error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return
+	}
+
+	settingsFile, err := os.Create(configDir + "/settings.json")
+	if err != nil {
+		return
+	}
+	defer settingsFile.Close()
+
+	settings.locker.Lock()
+	defer settings.locker.Unlock()
+
+	enc := json.NewEncoder(settingsFile)
+	err = enc.Encode(settings)
+	return
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CreateUniqueFile creates a new file in dir. If a file with the same name
+// already exists, a number is appended to the name, e.g. "photo (1).jpg".
+func CreateUniqueFile(dir, name string) (*os.File, error) {
+	// Don't let devices write outside of dir
+	name = filepath.Base(name)
+	if name == "." || name == "/" || name == ".." {
+		name = "file"
+	}
+
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	for i := 0; ; i++ {
+		candidate := name
+		if i > 0 {
+			candidate = stem + " (" + strconv.Itoa(i) + ")" + ext
+		}
+
+		f, err := os.OpenFile(filepath.Join(dir, candidate), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		return f, err
+	}
+}
+
+// OpenUrl opens a URL or a file with the default application.
+func OpenUrl(url string) error {
+	cmd := exec.Command("xdg-open", url)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	go cmd.Wait()
+	return nil
+}